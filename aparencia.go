@@ -0,0 +1,130 @@
+// aparencia.go - Símbolo e cor escolhidos pelos jogadores
+// O servidor valida a aparência pedida em Entrar: o símbolo deve ser um
+// caractere visível que ocupe uma única célula e que não seja usado pelo mapa,
+// e dois jogadores não podem ter o mesmo símbolo com a mesma cor. Quando a
+// aparência é recusada, a resposta traz sugestões de combinações livres.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Aparencia é a combinação de símbolo e cor de um jogador
+type Aparencia struct {
+	Simbolo rune
+	Cor     Cor
+}
+
+// Quantidade de sugestões enviadas quando uma aparência é recusada
+const quantidadeSugestoes = 5
+
+// Símbolos oferecidos no menu do cliente e usados nas sugestões do servidor
+var simbolosSugeridos = []rune("☺☻♥♦♠★●◆▲■@&$%ΩΣπ")
+
+// Largura de caracteres sem considerar a configuração regional: caracteres
+// de largura ambígua (como ☺) contam como uma célula, igual ao termbox
+var larguraCaracteres = &runewidth.Condition{}
+
+// ErroAparencia indica que o servidor recusou o símbolo ou a cor pedidos
+type ErroAparencia struct {
+	Mensagem  string
+	Sugestoes []Aparencia
+}
+
+func (e *ErroAparencia) Error() string {
+	return e.Mensagem
+}
+
+// validarAparencia verifica se o símbolo e a cor podem ser usados por um jogador
+func validarAparencia(a Aparencia) error {
+	if !unicode.IsPrint(a.Simbolo) || unicode.IsSpace(a.Simbolo) {
+		return fmt.Errorf("símbolo %q não é um caractere visível", a.Simbolo)
+	}
+	if larguraCaracteres.RuneWidth(a.Simbolo) != 1 {
+		return fmt.Errorf("símbolo %q não ocupa exatamente uma célula", a.Simbolo)
+	}
+	for _, elem := range []Elemento{Parede, Inimigo, Vegetacao} {
+		if a.Simbolo == elem.Simbolo {
+			return fmt.Errorf("símbolo %q é usado pelo mapa", a.Simbolo)
+		}
+	}
+	if a.Cor > CorCinzaClaro {
+		return errors.New("cor inválida")
+	}
+	return nil
+}
+
+// aparenciaEmUso indica se algum jogador já usa o símbolo com a mesma cor.
+// Deve ser chamada com o mutex do servidor travado.
+func (s *ServidorJogo) aparenciaEmUso(a Aparencia) bool {
+	for _, j := range s.jogadores {
+		if j.info.Simbolo == a.Simbolo && j.info.Cor == a.Cor {
+			return true
+		}
+	}
+	return false
+}
+
+// sugerirAparencias propõe combinações livres próximas da pedida: primeiro o
+// mesmo símbolo em outras cores, depois outros símbolos na mesma cor.
+// Deve ser chamada com o mutex do servidor travado.
+func (s *ServidorJogo) sugerirAparencias(pedida Aparencia) []Aparencia {
+	var sugestoes []Aparencia
+	adicionar := func(a Aparencia) bool {
+		if validarAparencia(a) == nil && !s.aparenciaEmUso(a) {
+			sugestoes = append(sugestoes, a)
+		}
+		return len(sugestoes) >= quantidadeSugestoes
+	}
+
+	if validarAparencia(Aparencia{Simbolo: pedida.Simbolo}) == nil {
+		for _, c := range nomesCores {
+			if c.Cor != pedida.Cor && adicionar(Aparencia{pedida.Simbolo, c.Cor}) {
+				return sugestoes
+			}
+		}
+	}
+	cor := pedida.Cor
+	if cor > CorCinzaClaro {
+		cor = CorPadrao
+	}
+	for _, simbolo := range simbolosSugeridos {
+		if simbolo != pedida.Simbolo && adicionar(Aparencia{simbolo, cor}) {
+			return sugestoes
+		}
+	}
+	return sugestoes
+}
+
+// verificarAparencia valida a aparência pedida em Entrar; se for recusada,
+// preenche a resposta com o motivo e as sugestões e retorna false.
+// Deve ser chamada com o mutex do servidor travado.
+func (s *ServidorJogo) verificarAparencia(a Aparencia, reply *EntrarReply) bool {
+	if err := validarAparencia(a); err != nil {
+		reply.Mensagem = err.Error()
+	} else if s.aparenciaEmUso(a) {
+		reply.Mensagem = fmt.Sprintf("símbolo %c na cor %s já está em uso", a.Simbolo, corNome(a.Cor))
+	} else {
+		return true
+	}
+	reply.Sucesso = false
+	reply.AparenciaRecusada = true
+	reply.Sugestoes = s.sugerirAparencias(a)
+	return false
+}
+
+// entrarComSugestao tenta entrar com a aparência pedida e, se o servidor a
+// recusar com sugestões, tenta novamente com a primeira sugestão. Usado por
+// clientes sem interface, que não podem perguntar ao jogador.
+func entrarComSugestao(entrar func(Aparencia) (*ClienteJogo, error), a Aparencia) (*ClienteJogo, error) {
+	cliente, err := entrar(a)
+	var erroAparencia *ErroAparencia
+	if errors.As(err, &erroAparencia) && len(erroAparencia.Sugestoes) > 0 {
+		return entrar(erroAparencia.Sugestoes[0])
+	}
+	return cliente, err
+}
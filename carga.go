@@ -0,0 +1,245 @@
+// carga.go - Teste de carga com um enxame de bots
+// O modo "carga" conecta N clientes simulados (sem interface) a um servidor,
+// cada um enviando movimentos a uma taxa configurada e consultando o estado,
+// e ao final relata vazão, latências de EnviarComando e ObterEstado, erros e
+// a justiça da distribuição dos comandos aceitos entre os bots.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpcoesCarga reúne as configurações do teste de carga
+type OpcoesCarga struct {
+	Endereco   string
+	Bots       int
+	Duracao    time.Duration
+	Taxa       float64       // movimentos por segundo de cada bot
+	TaxaEstado float64       // consultas de estado por segundo de cada bot
+	Pensar     time.Duration // tempo de pensamento máximo (aleatório) antes de cada movimento
+	Roteiro    string        // sequência de teclas repetida por cada bot; vazio = aleatório
+	Semente    int64
+}
+
+// resultadoBot acumula as medições de um bot
+type resultadoBot struct {
+	latComando []time.Duration // apenas dos comandos aceitos pelo servidor
+	latEstado  []time.Duration
+	erros      map[string]int // "conexao", "comando", "recusado" e "estado"
+	conectou   bool
+}
+
+// ExecutarCarga interpreta os argumentos do modo "carga" e executa o teste
+func ExecutarCarga(args []string) error {
+	opcoes := OpcoesCarga{}
+	fs := flag.NewFlagSet("carga", flag.ExitOnError)
+	fs.StringVar(&opcoes.Endereco, "endereco", "localhost:8080", "Endereço do servidor")
+	fs.IntVar(&opcoes.Bots, "bots", 10, "Quantidade de clientes simulados")
+	fs.DurationVar(&opcoes.Duracao, "duracao", 10*time.Second, "Duração do teste")
+	fs.Float64Var(&opcoes.Taxa, "taxa", 5, "Movimentos por segundo de cada bot")
+	fs.Float64Var(&opcoes.TaxaEstado, "taxa-estado", 10, "Consultas de estado por segundo de cada bot (0 desativa)")
+	fs.DurationVar(&opcoes.Pensar, "pensar", 0, "Tempo de pensamento máximo, sorteado antes de cada movimento")
+	fs.StringVar(&opcoes.Roteiro, "roteiro", "", "Teclas (wasd) repetidas por cada bot; vazio para passeio aleatório")
+	fs.Int64Var(&opcoes.Semente, "semente", 1, "Semente dos passeios aleatórios")
+	falhas := registrarFlagsFalhas(fs)
+	fs.DurationVar(&tempoLimiteChamada, "tempo-limite", tempoLimiteChamada, "Tempo máximo de espera por cada resposta do servidor (0 espera para sempre)")
+	fs.Parse(args)
+	falhasCliente = *falhas
+
+	if opcoes.Bots <= 0 || opcoes.Taxa <= 0 {
+		return fmt.Errorf("-bots e -taxa devem ser positivos")
+	}
+	for _, tecla := range opcoes.Roteiro {
+		if !strings.ContainsRune("wasd", tecla) {
+			return fmt.Errorf("roteiro aceita apenas as teclas w, a, s, d: %q", tecla)
+		}
+	}
+
+	fmt.Printf("Teste de carga: %d bots contra %s por %v (%.1f mov/s, %.1f estados/s por bot)\n",
+		opcoes.Bots, opcoes.Endereco, opcoes.Duracao, opcoes.Taxa, opcoes.TaxaEstado)
+
+	resultados := make([]*resultadoBot, opcoes.Bots)
+	var wg sync.WaitGroup
+	inicio := time.Now()
+	fim := inicio.Add(opcoes.Duracao)
+	for i := 0; i < opcoes.Bots; i++ {
+		resultados[i] = &resultadoBot{erros: make(map[string]int)}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			executarBot(i, opcoes, fim, resultados[i])
+		}(i)
+	}
+	wg.Wait()
+
+	relatarCarga(os.Stdout, resultados, time.Since(inicio))
+	return nil
+}
+
+// executarBot conecta um cliente simulado e o faz jogar até o fim do teste
+func executarBot(indice int, opcoes OpcoesCarga, fim time.Time, res *resultadoBot) {
+	// Cada bot recebe uma combinação diferente de letra e cor; se ainda assim
+	// houver colisão, a sugestão do servidor é aceita
+	simbolos := []rune("abcdefghijklmnopqrstuvwxyz")
+	aparencia := Aparencia{
+		Simbolo: simbolos[indice%len(simbolos)],
+		Cor:     nomesCores[(indice/len(simbolos))%len(nomesCores)].Cor,
+	}
+	nome := fmt.Sprintf("bot-%d", indice)
+	cliente, err := entrarComSugestao(func(a Aparencia) (*ClienteJogo, error) {
+		return NovoCliente(opcoes.Endereco, EntrarArgs{Nome: nome, Simbolo: a.Simbolo, Cor: a.Cor})
+	}, aparencia)
+	if err != nil {
+		res.erros["conexao"]++
+		return
+	}
+	res.conectou = true
+	defer cliente.Sair()
+
+	aleatorio := rand.New(rand.NewSource(opcoes.Semente + int64(indice)))
+
+	// Consultas de estado em paralelo com os movimentos, como faz o cliente real
+	var wg sync.WaitGroup
+	var mutexEstado sync.Mutex
+	if opcoes.TaxaEstado > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / opcoes.TaxaEstado))
+			defer ticker.Stop()
+			for agora := range ticker.C {
+				if agora.After(fim) {
+					return
+				}
+				inicio := time.Now()
+				_, err := cliente.ObterEstado()
+				duracao := time.Since(inicio)
+
+				mutexEstado.Lock()
+				if err != nil {
+					res.erros["estado"]++
+				} else {
+					res.latEstado = append(res.latEstado, duracao)
+				}
+				mutexEstado.Unlock()
+			}
+		}()
+	}
+
+	intervalo := time.Duration(float64(time.Second) / opcoes.Taxa)
+	proximo := time.Now()
+	for passo := 0; ; passo++ {
+		if opcoes.Pensar > 0 {
+			proximo = proximo.Add(time.Duration(aleatorio.Int63n(int64(opcoes.Pensar))))
+		}
+		time.Sleep(time.Until(proximo))
+		if time.Now().After(fim) {
+			break
+		}
+
+		var direcao Direcao
+		if opcoes.Roteiro != "" {
+			roteiro := []rune(opcoes.Roteiro)
+			direcao = direcaoDeTecla(roteiro[passo%len(roteiro)])
+		} else {
+			direcao = DirecaoCima + Direcao(aleatorio.Intn(4))
+		}
+
+		inicio := time.Now()
+		reply, err := cliente.EnviarComando(NovoComandoMover(direcao))
+		duracao := time.Since(inicio)
+
+		// Comandos recusados pelo servidor (pelos limites, por exemplo) não
+		// entram nas latências nem na justiça
+		mutexEstado.Lock()
+		switch {
+		case errors.Is(err, ErrRecusado) || (err == nil && !reply.Sucesso):
+			res.erros["recusado"]++
+		case err != nil:
+			res.erros["comando"]++
+		default:
+			res.latComando = append(res.latComando, duracao)
+		}
+		mutexEstado.Unlock()
+
+		proximo = proximo.Add(intervalo)
+	}
+
+	wg.Wait()
+}
+
+// percentil retorna o valor no percentil p (0-100) de latências já ordenadas
+func percentil(ordenadas []time.Duration, p float64) time.Duration {
+	if len(ordenadas) == 0 {
+		return 0
+	}
+	i := int(p / 100 * float64(len(ordenadas)-1))
+	return ordenadas[i]
+}
+
+// resumoLatencias escreve quantidade, vazão e percentis de uma série de latências
+func resumoLatencias(w io.Writer, nome string, latencias []time.Duration, duracao time.Duration) {
+	sort.Slice(latencias, func(i, j int) bool { return latencias[i] < latencias[j] })
+	fmt.Fprintf(w, "%-14s %8d chamadas  %8.1f/s  p50 %-10v p95 %-10v p99 %-10v max %v\n",
+		nome, len(latencias), float64(len(latencias))/duracao.Seconds(),
+		percentil(latencias, 50), percentil(latencias, 95), percentil(latencias, 99),
+		percentil(latencias, 100))
+}
+
+// relatarCarga imprime o relatório final do teste de carga
+func relatarCarga(w io.Writer, resultados []*resultadoBot, duracao time.Duration) {
+	var comandos, estados []time.Duration
+	erros := make(map[string]int)
+	conectados := 0
+	porBot := make([]float64, 0, len(resultados))
+	for _, res := range resultados {
+		comandos = append(comandos, res.latComando...)
+		estados = append(estados, res.latEstado...)
+		for tipo, n := range res.erros {
+			erros[tipo] += n
+		}
+		if res.conectou {
+			conectados++
+			porBot = append(porBot, float64(len(res.latComando)))
+		}
+	}
+
+	fmt.Fprintf(w, "\nDuração: %v, bots conectados: %d/%d\n", duracao.Round(time.Millisecond), conectados, len(resultados))
+	resumoLatencias(w, "EnviarComando", comandos, duracao)
+	resumoLatencias(w, "ObterEstado", estados, duracao)
+
+	fmt.Fprintf(w, "Erros: conexão %d, comando %d, recusados %d, estado %d\n",
+		erros["conexao"], erros["comando"], erros["recusado"], erros["estado"])
+
+	// Índice de justiça de Jain: 1 quando todos os bots tiveram o mesmo número
+	// de comandos aceitos, 1/n quando um único bot foi atendido
+	if len(porBot) > 0 {
+		soma, somaQuadrados := 0.0, 0.0
+		minimo, maximo := porBot[0], porBot[0]
+		for _, n := range porBot {
+			soma += n
+			somaQuadrados += n * n
+			if n < minimo {
+				minimo = n
+			}
+			if n > maximo {
+				maximo = n
+			}
+		}
+		justica := 0.0
+		if somaQuadrados > 0 {
+			justica = soma * soma / (float64(len(porBot)) * somaQuadrados)
+		}
+		fmt.Fprintf(w, "Justiça (Jain): %.3f, comandos por bot: mín %.0f, máx %.0f, média %.1f\n",
+			justica, minimo, maximo, soma/float64(len(porBot)))
+	}
+}
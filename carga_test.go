@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentil(t *testing.T) {
+	if p := percentil(nil, 50); p != 0 {
+		t.Errorf("percentil de nenhuma latência = %v", p)
+	}
+
+	var ordenadas []time.Duration
+	for i := 1; i <= 101; i++ {
+		ordenadas = append(ordenadas, time.Duration(i)*time.Millisecond)
+	}
+	casos := []struct {
+		p        float64
+		esperado time.Duration
+	}{
+		{0, 1 * time.Millisecond},
+		{50, 51 * time.Millisecond},
+		{95, 96 * time.Millisecond},
+		{99, 100 * time.Millisecond},
+		{100, 101 * time.Millisecond},
+	}
+	for _, c := range casos {
+		if p := percentil(ordenadas, c.p); p != c.esperado {
+			t.Errorf("p%v = %v, esperado %v", c.p, p, c.esperado)
+		}
+	}
+}
+
+func TestRelatarCargaSeparaRecusados(t *testing.T) {
+	ms := time.Millisecond
+	resultados := []*resultadoBot{
+		{conectou: true, latComando: []time.Duration{4 * ms, 1 * ms, 3 * ms, 2 * ms}, erros: map[string]int{}},
+		{conectou: true, erros: map[string]int{"recusado": 4, "estado": 1}},
+		{erros: map[string]int{"conexao": 1}},
+	}
+
+	var saida strings.Builder
+	relatarCarga(&saida, resultados, 2*time.Second)
+	relatorio := saida.String()
+
+	// O bot que só teve comandos recusados conta como não atendido
+	for _, esperado := range []string{
+		"bots conectados: 2/3",
+		"EnviarComando         4 chamadas       2.0/s  p50 2ms",
+		"Erros: conexão 1, comando 0, recusados 4, estado 1",
+		"Justiça (Jain): 0.500, comandos por bot: mín 0, máx 4, média 2.0",
+	} {
+		if !strings.Contains(relatorio, esperado) {
+			t.Errorf("relatório sem %q:\n%s", esperado, relatorio)
+		}
+	}
+}
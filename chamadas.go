@@ -0,0 +1,228 @@
+// chamadas.go - Chamadas RPC do cliente com tempo limite e cancelamento
+// Toda chamada do cliente ao servidor passa por chamar, que usa rpc.Client.Go
+// e espera a resposta, o tempo limite (-tempo-limite) ou o cancelamento do
+// contexto, o que vier primeiro. Assim um servidor travado nunca prende o
+// cliente. As falhas são classificadas em ErroChamada: tempo esgotado,
+// desconectado, recusado pelo servidor ou cancelado pelo próprio cliente.
+//
+// O cliente também acompanha as chamadas em andamento, para que a interface
+// mostre um indicador enquanto espera o servidor.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tempo máximo de espera por uma resposta do servidor (zero espera para
+// sempre). Definido pela opção -tempo-limite.
+var tempoLimiteChamada = 5 * time.Second
+
+// Espera a partir da qual a interface mostra o indicador de conexão
+const esperaVisivel = 300 * time.Millisecond
+
+// TipoFalha classifica a falha de uma chamada ao servidor
+type TipoFalha uint8
+
+const (
+	FalhaTempoEsgotado TipoFalha = iota + 1 // o servidor não respondeu a tempo
+	FalhaDesconectado                       // a conexão caiu ou o servidor foi encerrado
+	FalhaRecusada                           // o servidor respondeu recusando a chamada
+	FalhaCancelada                          // o cliente saiu antes da resposta
+)
+
+// Nomes dos tipos de falha, usados nas mensagens e na saída do roteiro
+var nomesFalhas = map[TipoFalha]string{
+	FalhaTempoEsgotado: "tempo_esgotado",
+	FalhaDesconectado:  "desconectado",
+	FalhaRecusada:      "recusado",
+	FalhaCancelada:     "cancelado",
+}
+
+// String retorna o nome do tipo de falha
+func (t TipoFalha) String() string {
+	return nomesFalhas[t]
+}
+
+// Erros para comparar com errors.Is; um ErroChamada é igual ao do seu tipo
+var (
+	ErrTempoEsgotado = errors.New("tempo esgotado esperando o servidor")
+	ErrDesconectado  = errors.New("desconectado do servidor")
+	ErrRecusado      = errors.New("recusado pelo servidor")
+	ErrCancelado     = errors.New("chamada cancelada")
+)
+
+// ErroChamada é a falha de uma chamada ao servidor
+type ErroChamada struct {
+	Metodo string    // método RPC, ex. ServidorJogo.EnviarComando
+	Tipo   TipoFalha // classificação da falha
+	Motivo string    // detalhe: a mensagem do servidor ou o erro da conexão
+}
+
+func (e *ErroChamada) Error() string {
+	texto := e.sentinela().Error()
+	if e.Motivo != "" {
+		texto += ": " + e.Motivo
+	}
+	return texto
+}
+
+// Is permite comparar o erro com ErrTempoEsgotado, ErrDesconectado, ErrRecusado
+// e ErrCancelado
+func (e *ErroChamada) Is(alvo error) bool {
+	return alvo == e.sentinela()
+}
+
+// sentinela retorna o erro de comparação do tipo da falha
+func (e *ErroChamada) sentinela() error {
+	switch e.Tipo {
+	case FalhaTempoEsgotado:
+		return ErrTempoEsgotado
+	case FalhaDesconectado:
+		return ErrDesconectado
+	case FalhaCancelada:
+		return ErrCancelado
+	}
+	return ErrRecusado
+}
+
+// recusada cria o erro de uma chamada que o servidor respondeu sem sucesso
+func recusada(metodo, mensagem string) error {
+	return &ErroChamada{Metodo: metodo, Tipo: FalhaRecusada, Motivo: mensagem}
+}
+
+// chamar faz a chamada RPC e espera a resposta até o tempo limite ou o
+// cancelamento de ctx. A resposta é decodificada em um valor próprio da
+// chamada e só copiada para reply se chegar a tempo: a chamada abandonada
+// continua pendente no rpc.Client, e sua resposta, se chegar, é descartada
+// sem tocar em reply.
+func chamar(ctx context.Context, client *rpc.Client, metodo string, args, reply interface{}) error {
+	if tempoLimiteChamada > 0 {
+		var cancelar context.CancelFunc
+		ctx, cancelar = context.WithTimeout(ctx, tempoLimiteChamada)
+		defer cancelar()
+	}
+
+	resposta := reflect.New(reflect.TypeOf(reply).Elem())
+	chamada := client.Go(metodo, args, resposta.Interface(), make(chan *rpc.Call, 1))
+	select {
+	case <-chamada.Done:
+		if chamada.Error == nil {
+			reflect.ValueOf(reply).Elem().Set(resposta.Elem())
+		}
+		return classificarFalha(metodo, chamada.Error)
+	case <-ctx.Done():
+		go descartarChamada(chamada)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return &ErroChamada{Metodo: metodo, Tipo: FalhaTempoEsgotado, Motivo: fmt.Sprintf("sem resposta em %v", tempoLimiteChamada)}
+		}
+		return &ErroChamada{Metodo: metodo, Tipo: FalhaCancelada}
+	}
+}
+
+// descartarChamada espera o fim de uma chamada abandonada: a resposta
+// atrasada ou o fechamento da conexão, que encerra as chamadas pendentes
+func descartarChamada(chamada *rpc.Call) {
+	<-chamada.Done
+}
+
+// classificarFalha converte o erro devolvido por net/rpc em um ErroChamada
+func classificarFalha(metodo string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var erroServidor rpc.ServerError
+	if errors.As(err, &erroServidor) && string(erroServidor) != MensagemServidorEncerrado {
+		return &ErroChamada{Metodo: metodo, Tipo: FalhaRecusada, Motivo: string(erroServidor)}
+	}
+	var erroRede net.Error
+	if errors.As(err, &erroRede) && erroRede.Timeout() {
+		return &ErroChamada{Metodo: metodo, Tipo: FalhaTempoEsgotado, Motivo: err.Error()}
+	}
+	return &ErroChamada{Metodo: metodo, Tipo: FalhaDesconectado, Motivo: err.Error()}
+}
+
+// erroDeEncerramento indica se a falha de uma chamada encerra a conexão: o
+// servidor foi encerrado (recusou a chamada) ou a conexão caiu. Uma chamada
+// cancelada por Sair não conta: quem saiu ainda precisa avisar o servidor.
+func erroDeEncerramento(err error) bool {
+	return errors.Is(err, ErrDesconectado)
+}
+
+// chamadasPendentes registra o início das chamadas em andamento
+type chamadasPendentes struct {
+	mutex   sync.Mutex
+	proxima uint64
+	inicio  map[uint64]time.Time
+}
+
+// iniciar registra uma chamada e retorna seu identificador
+func (p *chamadasPendentes) iniciar() uint64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.inicio == nil {
+		p.inicio = make(map[uint64]time.Time)
+	}
+	p.proxima++
+	p.inicio[p.proxima] = time.Now()
+	return p.proxima
+}
+
+// terminar remove a chamada das pendentes
+func (p *chamadasPendentes) terminar(id uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.inicio, id)
+}
+
+// resumo retorna quantas chamadas estão em andamento e há quanto tempo a mais
+// antiga espera
+func (p *chamadasPendentes) resumo() (quantas int, espera time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	agora := time.Now()
+	for _, inicio := range p.inicio {
+		if d := agora.Sub(inicio); d > espera {
+			espera = d
+		}
+	}
+	return len(p.inicio), espera
+}
+
+// chamar faz a chamada pela conexão, cancelada quando o cliente sai, mede o
+// tempo de ida e volta quando o servidor responde e marca a conexão como
+// encerrada se o servidor tiver sido encerrado
+func (conexao *ClienteRPC) chamar(metodo string, args, reply interface{}) error {
+	id := conexao.pendentes.iniciar()
+	defer conexao.pendentes.terminar(id)
+
+	inicio := time.Now()
+	err := chamar(conexao.contexto, conexao.Client, metodo, args, reply)
+	if err == nil || errors.Is(err, ErrRecusado) {
+		conexao.latencia.observar(time.Since(inicio))
+	}
+	if erroDeEncerramento(err) {
+		atomic.StoreInt32(&conexao.encerrado, 1)
+	}
+	return err
+}
+
+// ChamadasPendentes retorna quantas chamadas ao servidor estão em andamento e
+// há quanto tempo a mais antiga espera resposta
+func (c *ClienteJogo) ChamadasPendentes() (quantas int, espera time.Duration) {
+	conexao := c.conexao
+	if conexao == nil {
+		return 0, 0
+	}
+	return conexao.pendentes.resumo()
+}
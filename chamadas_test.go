@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ServicoLento responde a Esperar só depois que liberar for fechado
+type ServicoLento struct {
+	liberar   chan struct{}
+	respondeu chan struct{}
+}
+
+func (s *ServicoLento) Esperar(args *int, reply *int) error {
+	<-s.liberar
+	*reply = *args
+	close(s.respondeu)
+	return nil
+}
+
+func (s *ServicoLento) Eco(args *int, reply *int) error {
+	*reply = *args
+	return nil
+}
+
+func TestChamadaAbandonadaNaoEscreveNaResposta(t *testing.T) {
+	anterior := tempoLimiteChamada
+	tempoLimiteChamada = 20 * time.Millisecond
+	defer func() { tempoLimiteChamada = anterior }()
+
+	servico := &ServicoLento{liberar: make(chan struct{}), respondeu: make(chan struct{})}
+	servidor := rpc.NewServer()
+	if err := servidor.RegisterName("Lento", servico); err != nil {
+		t.Fatal(err)
+	}
+	ladoServidor, ladoCliente := net.Pipe()
+	go servidor.ServeConn(ladoServidor)
+	client := rpc.NewClient(ladoCliente)
+	defer client.Close()
+
+	args, reply := 42, 0
+	err := chamar(context.Background(), client, "Lento.Esperar", &args, &reply)
+	if !errors.Is(err, ErrTempoEsgotado) {
+		t.Fatalf("chamar = %v, esperado tempo esgotado", err)
+	}
+
+	// A resposta atrasada chega depois que chamar retornou e é descartada
+	close(servico.liberar)
+	<-servico.respondeu
+	eco := 7
+	if err := chamar(context.Background(), client, "Lento.Eco", &eco, &eco); err != nil {
+		t.Fatal(err)
+	}
+	if reply != 0 {
+		t.Errorf("a resposta abandonada foi escrita em reply: %d", reply)
+	}
+}
+
+func TestChamadaCanceladaNaoEncerraConexao(t *testing.T) {
+	servico := &ServicoLento{liberar: make(chan struct{}), respondeu: make(chan struct{})}
+	defer close(servico.liberar)
+	servidor := rpc.NewServer()
+	if err := servidor.RegisterName("Lento", servico); err != nil {
+		t.Fatal(err)
+	}
+	ladoServidor, ladoCliente := net.Pipe()
+	go servidor.ServeConn(ladoServidor)
+	contexto, cancelar := context.WithCancel(context.Background())
+	conexao := &ClienteRPC{Client: rpc.NewClient(ladoCliente), contexto: contexto, cancelar: cancelar}
+	defer conexao.Client.Close()
+
+	// O cliente sai com uma chamada em andamento
+	time.AfterFunc(10*time.Millisecond, cancelar)
+	args, reply := 42, 0
+	err := conexao.chamar("Lento.Esperar", &args, &reply)
+	if !errors.Is(err, ErrCancelado) || errors.Is(err, ErrDesconectado) {
+		t.Fatalf("chamar = %v, esperado cancelado", err)
+	}
+	if atomic.LoadInt32(&conexao.encerrado) != 0 {
+		t.Fatal("a chamada cancelada marcou a conexão como encerrada")
+	}
+}
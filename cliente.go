@@ -1,45 +1,91 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/rpc"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Cliente RPC para comunicação com o servidor
-var clienteRPC *ClienteRPC
-
-// ClienteRPC encapsula a comunicação RPC
+// ClienteRPC encapsula a comunicação RPC de um cliente
 type ClienteRPC struct {
-	Client  *rpc.Client
-	Estado  EstadoJogo
+	Client    *rpc.Client
+	encerrado int32 // 1 quando o servidor foi encerrado (acesso atômico)
+
+	mutex  sync.Mutex // protege Estado, atualizado pela goroutine de atualização
+	Estado EstadoJogo
+
+	// Cancelado por Sair: encerra a atualização periódica e as chamadas em
+	// andamento (veja chamadas.go)
+	contexto context.Context
+	cancelar context.CancelFunc
+
+	pendentes chamadasPendentes // chamadas em andamento, para o indicador da interface
+	latencia  medidorLatencia   // RTT das chamadas (veja rtt.go)
+
+	// Último aviso de quem apareceu ou sumiu da área de interesse e quando
+	// chegou (veja interesse.go); protegidos por mutex
+	vizinhanca      string
+	avisoVizinhanca time.Time
 }
 
-// NovoCliente estabelece uma conexão com o servidor
-func NovoCliente(endereco, nome string, simbolo rune, cor Cor) (*ClienteJogo, error) {
+// NovoCliente estabelece uma conexão com o servidor e entra no jogo.
+// A atualização periódica do estado é iniciada à parte, com IniciarAtualizacao.
+func NovoCliente(endereco string, args EntrarArgs) (*ClienteJogo, error) {
 	// Tentar estabelecer conexão RPC
-	client, err := rpc.Dial("tcp", endereco)
+	client, err := discar(endereco)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao conectar ao servidor: %v", err)
 	}
 
-	// Criar cliente RPC global
-	clienteRPC = &ClienteRPC{
-		Client: client,
-		Estado: EstadoJogo{
-			Jogadores: make(map[int]JogadorInfo),
-		},
+	return entrarNoJogo(client, args)
+}
+
+// discar abre a conexão RPC com o servidor, com as falhas de rede simuladas
+// configuradas (veja falhas.go)
+func discar(endereco string) (*rpc.Client, error) {
+	conn, err := net.Dial("tcp", endereco)
+	if err != nil {
+		return nil, err
 	}
+	return rpc.NewClient(comFalhas(conn, falhasCliente)), nil
+}
 
-	// Tentar entrar no jogo
-	args := EntrarArgs{
-		Nome:    nome,
-		Simbolo: simbolo,
-		Cor:     cor,
+// RegistrarConta cria uma conta de jogador no servidor e retorna o nome da
+// conta, já limpo pelo servidor
+func RegistrarConta(endereco, nome, senha string) (string, error) {
+	client, err := discar(endereco)
+	if err != nil {
+		return "", fmt.Errorf("erro ao conectar ao servidor: %v", err)
 	}
+
+	return registrarConta(client, nome, senha)
+}
+
+// registrarConta cria a conta pela conexão RPC informada e a fecha
+func registrarConta(client *rpc.Client, nome, senha string) (string, error) {
+	defer client.Close()
+
+	reply := RegistrarReply{}
+	err := chamar(context.Background(), client, "ServidorJogo.Registrar", &RegistrarArgs{Nome: nome, Senha: senha}, &reply)
+	if err != nil {
+		return "", fmt.Errorf("erro ao registrar a conta: %v", err)
+	}
+	if !reply.Sucesso {
+		return "", fmt.Errorf("não foi possível registrar a conta: %s", reply.Mensagem)
+	}
+	return reply.Nome, nil
+}
+
+// entrarNoJogo entra no jogo pela conexão RPC informada e cria o cliente.
+// A conexão é fechada se não for possível entrar.
+func entrarNoJogo(client *rpc.Client, args EntrarArgs) (*ClienteJogo, error) {
 	reply := EntrarReply{}
-	
-	err = client.Call("ServidorJogo.Entrar", &args, &reply)
+
+	err := chamar(context.Background(), client, "ServidorJogo.Entrar", &args, &reply)
 	if err != nil {
 		client.Close()
 		return nil, fmt.Errorf("erro ao entrar no jogo: %v", err)
@@ -47,97 +93,301 @@ func NovoCliente(endereco, nome string, simbolo rune, cor Cor) (*ClienteJogo, er
 
 	if !reply.Sucesso {
 		client.Close()
+		if reply.AparenciaRecusada {
+			return nil, &ErroAparencia{Mensagem: reply.Mensagem, Sugestoes: reply.Sugestoes}
+		}
 		return nil, fmt.Errorf("não foi possível entrar no jogo: %s", reply.Mensagem)
 	}
 
 	// Criar objeto de cliente local
+	// O servidor pode ter ajustado o nome (ex. sufixo para nomes repetidos)
+	contexto, cancelar := context.WithCancel(context.Background())
 	c := &ClienteJogo{
 		ID:      reply.JogadorID,
-		Nome:    nome,
-		Simbolo: simbolo,
-		Cor:     cor,
+		Nome:    reply.Nome,
+		Simbolo: args.Simbolo,
+		Cor:     args.Cor,
+		sessao:  reply.Sessao,
+		conexao: &ClienteRPC{
+			Client:   client,
+			Estado:   reply.Estado,
+			contexto: contexto,
+			cancelar: cancelar,
+		},
+	}
+	if jogador, existe := reply.Estado.Jogadores[c.ID]; existe {
+		c.PosX, c.PosY = jogador.PosX, jogador.PosY
 	}
-
-	// Atualizar estado
-	clienteRPC.Estado = reply.Estado
-	
-	// Iniciar goroutine para atualizações periódicas
-	go atualizarEstadoPeriodicamente()
 
 	return c, nil
 }
 
-// EnviarComando envia um comando para o servidor
-func (c *ClienteJogo) EnviarComando(tipo string, tecla rune) error {
-	if clienteRPC == nil || clienteRPC.Client == nil {
-		return fmt.Errorf("cliente não está conectado")
-	}
+// IniciarAtualizacao inicia a goroutine que obtém o estado do jogo a cada
+// intervalo, e a que chama Ping a cada intervaloPing para medir o RTT.
+// aoMudar (se não for nil) é chamada quando o estado muda, quando o servidor
+// é encerrado, a cada nova medida de RTT e, a cada intervalo, enquanto alguma
+// chamada espera o servidor por mais de esperaVisivel; é chamada a partir de
+// outras goroutines.
+func (c *ClienteJogo) IniciarAtualizacao(intervalo time.Duration, aoMudar func()) {
+	go c.atualizarEstadoPeriodicamente(intervalo, aoMudar)
+	go c.vigiarChamadas(intervalo, aoMudar)
+	go c.pingarPeriodicamente(aoMudar)
+}
 
-	args := EnviarComandoArgs{
+// EnviarComando envia um comando para o servidor e retorna o resultado.
+// A posição do jogador na cópia local do estado é atualizada com a resposta,
+// sem esperar a próxima atualização periódica.
+func (c *ClienteJogo) EnviarComando(comando Comando) (EnviarComandoReply, error) {
+	return c.enviar(EnviarComandoArgs{
 		JogadorID: c.ID,
-		Tipo:      tipo,
-		Tecla:     tecla,
+		Comando:   comando,
+	})
+}
+
+// enviador retorna uma função que envia comandos pela conexão atual, para ser
+// usada por outra goroutine: depois de Sair ela continua válida e só falha
+func (c *ClienteJogo) enviador() func(Comando) (EnviarComandoReply, error) {
+	conexao := c.conexao
+	return func(comando Comando) (EnviarComandoReply, error) {
+		return c.enviarPor(conexao, EnviarComandoArgs{JogadorID: c.ID, Comando: comando})
+	}
+}
+
+// EnviarMensagem envia uma mensagem de chat para os outros jogadores
+func (c *ClienteJogo) EnviarMensagem(texto string) error {
+	_, err := c.EnviarComando(NovoComandoChat(texto))
+	return err
+}
+
+// enviar faz a chamada EnviarComando com os argumentos informados
+func (c *ClienteJogo) enviar(args EnviarComandoArgs) (EnviarComandoReply, error) {
+	reply, err := c.enviarPor(c.conexao, args)
+	if err == nil {
+		c.PosX, c.PosY = reply.PosX, reply.PosY
 	}
+	return reply, err
+}
+
+// enviarPor faz a chamada EnviarComando pela conexão informada. Pode ser
+// usada por outras goroutines, que guardam a conexão antes de Sair anulá-la.
+func (c *ClienteJogo) enviarPor(conexao *ClienteRPC, args EnviarComandoArgs) (EnviarComandoReply, error) {
 	reply := EnviarComandoReply{}
+	if conexao == nil || conexao.Client == nil {
+		return reply, fmt.Errorf("cliente não está conectado")
+	}
 
-	err := clienteRPC.Client.Call("ServidorJogo.EnviarComando", &args, &reply)
-	if err != nil {
-		return fmt.Errorf("erro ao enviar comando: %v", err)
+	args.Sessao = c.sessao
+	if err := conexao.chamar("ServidorJogo.EnviarComando", &args, &reply); err != nil {
+		return reply, err
 	}
 
 	if !reply.Sucesso {
-		return fmt.Errorf("erro no servidor: %s", reply.Mensagem)
+		return reply, recusada("ServidorJogo.EnviarComando", reply.Mensagem)
 	}
 
-	return nil
+	c.aplicarResultado(conexao, reply)
+	return reply, nil
+}
+
+// aplicarResultado atualiza a posição do jogador na cópia local do estado
+// com o resultado de um comando, se ele for mais recente que a cópia
+func (c *ClienteJogo) aplicarResultado(conexao *ClienteRPC, reply EnviarComandoReply) {
+	conexao.mutex.Lock()
+	defer conexao.mutex.Unlock()
+
+	if reply.Versao <= conexao.Estado.Versao {
+		return
+	}
+	jogador, existe := conexao.Estado.Jogadores[c.ID]
+	if !existe {
+		return
+	}
+
+	// O mapa de jogadores pode estar em uso por quem chamou Estado; substituí-lo
+	// por uma cópia em vez de alterá-lo
+	jogadores := make(map[int]JogadorInfo, len(conexao.Estado.Jogadores))
+	for id, j := range conexao.Estado.Jogadores {
+		jogadores[id] = j
+	}
+	jogador.PosX, jogador.PosY = reply.PosX, reply.PosY
+	jogador.UltimaSequencia = reply.Sequencia
+	jogadores[c.ID] = jogador
+	conexao.Estado.Jogadores = jogadores
+	conexao.Estado.Versao = reply.Versao
+}
+
+// ObterEstado busca o estado atual no servidor e atualiza a cópia local
+func (c *ClienteJogo) ObterEstado() (EstadoJogo, error) {
+	if c.conexao == nil || c.conexao.Client == nil {
+		return EstadoJogo{}, fmt.Errorf("cliente não está conectado")
+	}
+
+	args := ObterEstadoArgs{
+		JogadorID: c.ID,
+		Sessao:    c.sessao,
+	}
+	reply := ObterEstadoReply{}
+
+	if err := c.conexao.chamar("ServidorJogo.ObterEstado", &args, &reply); err != nil {
+		return EstadoJogo{}, err
+	}
+
+	if !reply.Sucesso {
+		return EstadoJogo{}, recusada("ServidorJogo.ObterEstado", reply.Mensagem)
+	}
+
+	c.conexao.mutex.Lock()
+	anterior := c.conexao.Estado
+	c.conexao.Estado = reply.Estado
+	c.conexao.mutex.Unlock()
+	c.avisarVizinhanca(c.conexao, anterior, reply.Estado, reply.Apareceram, reply.Sumiram)
+
+	if jogador, existe := reply.Estado.Jogadores[c.ID]; existe {
+		c.PosX, c.PosY = jogador.PosX, jogador.PosY
+	}
+
+	return reply.Estado, nil
+}
+
+// Estado retorna a última cópia do estado recebida do servidor
+func (c *ClienteJogo) Estado() EstadoJogo {
+	if c.conexao == nil {
+		return EstadoJogo{}
+	}
+
+	c.conexao.mutex.Lock()
+	defer c.conexao.mutex.Unlock()
+
+	return c.conexao.Estado
+}
+
+// ServidorEncerrado indica se a conexão terminou porque o servidor foi encerrado
+func (c *ClienteJogo) ServidorEncerrado() bool {
+	return c.conexao != nil && atomic.LoadInt32(&c.conexao.encerrado) == 1
 }
 
 // Sair desconecta o cliente do servidor
 func (c *ClienteJogo) Sair() error {
-	if clienteRPC == nil || clienteRPC.Client == nil {
+	conexao := c.conexao
+	if conexao == nil || conexao.Client == nil {
+		return nil
+	}
+	c.conexao = nil
+	encerrado := atomic.LoadInt32(&conexao.encerrado) == 1
+	conexao.cancelar()
+
+	// Com o servidor encerrado basta fechar a conexão
+	if encerrado {
+		conexao.Client.Close()
 		return nil
 	}
 
 	args := SairArgs{
 		JogadorID: c.ID,
+		Sessao:    c.sessao,
 	}
 	reply := SairReply{}
 
-	err := clienteRPC.Client.Call("ServidorJogo.Sair", &args, &reply)
+	// As chamadas da conexão já foram canceladas; Sair usa um contexto próprio
+	err := chamar(context.Background(), conexao.Client, "ServidorJogo.Sair", &args, &reply)
 	if err != nil {
 		fmt.Printf("Aviso: erro ao sair do servidor: %v\n", err)
 	}
-	
+
 	// Fechar conexão
-	clienteRPC.Client.Close()
-	clienteRPC = nil
-	
+	conexao.Client.Close()
+
 	return nil
 }
 
 // atualizarEstadoPeriodicamente obtém o estado do jogo a cada intervalo
-func atualizarEstadoPeriodicamente() {
-	ticker := time.NewTicker(100 * time.Millisecond)
+func (c *ClienteJogo) atualizarEstadoPeriodicamente(intervalo time.Duration, aoMudar func()) {
+	ticker := time.NewTicker(intervalo)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if clienteRPC == nil || clienteRPC.Client == nil {
+	conexao := c.conexao
+	if conexao == nil {
+		return
+	}
+	avisar := func() {
+		if aoMudar != nil {
+			aoMudar()
+		}
+	}
+
+	predicao := c.predicao
+	versao := c.Estado().Versao
+	for {
+		select {
+		case <-conexao.contexto.Done():
 			return
+		case <-ticker.C:
 		}
 
 		args := ObterEstadoArgs{
-			JogadorID: clienteRPC.Estado.Jogadores[0].ID, // Usar primeiro jogador como ID
+			JogadorID: c.ID,
+			Sessao:    c.sessao,
 		}
 		reply := ObterEstadoReply{}
 
-		err := clienteRPC.Client.Call("ServidorJogo.ObterEstado", &args, &reply)
+		err := conexao.chamar("ServidorJogo.ObterEstado", &args, &reply)
 		if err != nil {
-			fmt.Printf("Erro ao atualizar estado: %v\n", err)
+			if erroDeEncerramento(err) {
+				// Avisar para que o jogo seja encerrado
+				avisar()
+				return
+			}
 			continue
 		}
 
 		if reply.Sucesso {
-			clienteRPC.Estado = reply.Estado
+			// Um estado mais antigo que o resultado de um comando já aplicado
+			// (veja aplicarResultado) é descartado
+			conexao.mutex.Lock()
+			anterior := conexao.Estado
+			recente := reply.Estado.Versao >= conexao.Estado.Versao
+			if recente {
+				conexao.Estado = reply.Estado
+			}
+			conexao.mutex.Unlock()
+			c.avisarVizinhanca(conexao, anterior, reply.Estado, reply.Apareceram, reply.Sumiram)
+
+			jogador, existe := reply.Estado.Jogadores[c.ID]
+			if recente && existe && predicao != nil {
+				predicao.reconciliar(&reply.Estado, jogador.UltimaSequencia, jogador.PosX, jogador.PosY)
+			}
+
+			if reply.Estado.Versao != versao {
+				versao = reply.Estado.Versao
+				avisar()
+			}
+		}
+	}
+}
+
+// vigiarChamadas chama aoMudar a cada intervalo enquanto alguma chamada
+// espera o servidor por mais de esperaVisivel, e uma última vez quando a
+// espera termina, para que a interface atualize o indicador de conexão
+func (c *ClienteJogo) vigiarChamadas(intervalo time.Duration, aoMudar func()) {
+	conexao := c.conexao
+	if conexao == nil || aoMudar == nil {
+		return
+	}
+	ticker := time.NewTicker(intervalo)
+	defer ticker.Stop()
+
+	esperando := false
+	for {
+		select {
+		case <-conexao.contexto.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, espera := conexao.pendentes.resumo()
+		if espera >= esperaVisivel || esperando {
+			aoMudar()
 		}
+		esperando = espera >= esperaVisivel
 	}
 }
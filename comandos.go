@@ -0,0 +1,158 @@
+// comandos.go - Comandos enviados pelos jogadores ao servidor
+// Cada comando tem um tipo enumerado e os dados que esse tipo usa: a direção
+// de um movimento, a célula alvo de uma interação, o item a usar ou o texto
+// de uma mensagem. validarComando concentra todas as regras de validação;
+// comandos desconhecidos ou malformados são recusados com o motivo.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TipoComando identifica a ação pedida por um comando
+type TipoComando uint8
+
+const (
+	ComandoNenhum    TipoComando = iota // comando ausente ou desconhecido
+	ComandoMover                        // mover um passo na direção
+	ComandoInteragir                    // interagir com a célula alvo
+	ComandoChat                         // enviar uma mensagem de chat
+	ComandoUsar                         // usar um item do inventário
+)
+
+// Nomes dos tipos de comando, usados no registro de eventos e no JSON-RPC
+var nomesComandos = map[TipoComando]string{
+	ComandoMover:     "mover",
+	ComandoInteragir: "interagir",
+	ComandoChat:      "chat",
+	ComandoUsar:      "usar",
+}
+
+// String retorna o nome do tipo de comando ("" para ComandoNenhum)
+func (t TipoComando) String() string {
+	return nomesComandos[t]
+}
+
+// tipoComandoPorNome retorna o tipo de comando com o nome informado
+func tipoComandoPorNome(nome string) (TipoComando, bool) {
+	for t, n := range nomesComandos {
+		if n == nome {
+			return t, true
+		}
+	}
+	return ComandoNenhum, false
+}
+
+// Comando é uma ação de um jogador. Apenas os campos do tipo do comando são
+// considerados; os demais devem ficar vazios.
+type Comando struct {
+	Tipo    TipoComando
+	Direcao Direcao  // ComandoMover
+	Alvo    *Posicao // ComandoInteragir: célula alvo (nil para a posição do jogador)
+	Item    int      // ComandoUsar: ID do item no inventário
+	Texto   string   // ComandoChat
+}
+
+// NovoComandoMover cria um comando de movimento na direção informada
+func NovoComandoMover(direcao Direcao) Comando {
+	return Comando{Tipo: ComandoMover, Direcao: direcao}
+}
+
+// NovoComandoInteragir cria um comando de interação na posição do jogador
+func NovoComandoInteragir() Comando {
+	return Comando{Tipo: ComandoInteragir}
+}
+
+// NovoComandoChat cria um comando de mensagem de chat
+func NovoComandoChat(texto string) Comando {
+	return Comando{Tipo: ComandoChat, Texto: texto}
+}
+
+// validarComando verifica se o jogador pode executar o comando e normaliza
+// seus dados (o texto do chat é aparado e limitado a tamanhoMaximoChat).
+// Deve ser chamada com o mutex do servidor travado.
+func (s *ServidorJogo) validarComando(c *Comando, jogador JogadorInfo) error {
+	switch c.Tipo {
+	case ComandoMover:
+		if c.Direcao.String() == "" {
+			return errors.New("direção inválida")
+		}
+
+	case ComandoInteragir:
+		if c.Alvo == nil {
+			return nil
+		}
+		dx, dy := c.Alvo.X-jogador.PosX, c.Alvo.Y-jogador.PosY
+		if dx*dx+dy*dy > 1 {
+			return fmt.Errorf("a célula (%d, %d) está longe demais para interagir", c.Alvo.X, c.Alvo.Y)
+		}
+		if c.Alvo.Y < 0 || c.Alvo.Y >= len(s.estado.ElementosMapa) ||
+			c.Alvo.X < 0 || c.Alvo.X >= len(s.estado.ElementosMapa[c.Alvo.Y]) {
+			return fmt.Errorf("a célula (%d, %d) está fora do mapa", c.Alvo.X, c.Alvo.Y)
+		}
+
+	case ComandoChat:
+		texto := strings.TrimSpace(c.Texto)
+		if texto == "" {
+			return errors.New("Mensagem vazia")
+		}
+		if r := []rune(texto); len(r) > tamanhoMaximoChat {
+			texto = string(r[:tamanhoMaximoChat])
+		}
+		c.Texto = texto
+
+	case ComandoUsar:
+		// O jogo ainda não tem inventário: nenhum item pode ser usado
+		if c.Item <= 0 {
+			return errors.New("item inválido")
+		}
+		return fmt.Errorf("o item %d não está no seu inventário", c.Item)
+
+	default:
+		return fmt.Errorf("comando desconhecido (%d)", c.Tipo)
+	}
+	return nil
+}
+
+// comandoLegado é o formato de EnviarComandoArgs usado antes dos comandos
+// tipados, com o tipo como texto e a tecla de movimento
+type comandoLegado struct {
+	Tipo    string
+	Tecla   rune
+	Direcao Direcao
+	Texto   string
+}
+
+// argsComando tem os campos de EnviarComandoArgs sem o seu UnmarshalJSON
+type argsComando EnviarComandoArgs
+
+// UnmarshalJSON lê os argumentos de um comando do registro de eventos,
+// aceitando também o formato antigo para que registros gravados antes dos
+// comandos tipados continuem reproduzíveis
+func (a *EnviarComandoArgs) UnmarshalJSON(dados []byte) error {
+	var campos struct {
+		argsComando
+		Comando *Comando // ausente no formato antigo
+		comandoLegado
+	}
+	if err := json.Unmarshal(dados, &campos); err != nil {
+		return err
+	}
+
+	*a = EnviarComandoArgs(campos.argsComando)
+	if campos.Comando != nil {
+		a.Comando = *campos.Comando
+		return nil
+	}
+
+	legado := campos.comandoLegado
+	a.Comando = Comando{Texto: legado.Texto, Direcao: legado.Direcao}
+	a.Comando.Tipo, _ = tipoComandoPorNome(legado.Tipo)
+	if a.Comando.Tipo == ComandoMover && a.Comando.Direcao == DirecaoNenhuma {
+		a.Comando.Direcao = direcaoDeTecla(legado.Tecla)
+	}
+	return nil
+}
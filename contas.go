@@ -0,0 +1,466 @@
+// contas.go - Contas de jogadores com progresso salvo
+// Uma conta é criada com Registrar (nome e senha) e guardada em um arquivo
+// JSON, com a senha apenas como hash PBKDF2 com sal. O nome de uma conta fica
+// reservado: Entrar com ele exige a senha. Para cada conta o servidor guarda
+// a última posição, onde o jogador reaparece na próxima sessão, e estatísticas
+// de jogo. O jogo ainda não tem inventário; quando tiver, ele deve ser
+// guardado aqui junto com a posição.
+//
+// O hash da senha é lento de propósito e a gravação do arquivo espera o
+// disco; os dois acontecem fora do mutex do servidor, para que um login não
+// pare o jogo. Cada conta aceita poucas tentativas de senha seguidas e o
+// servidor todo calcula um número limitado de hashes por segundo.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Parâmetros do hash de senha (PBKDF2 com HMAC-SHA256)
+const (
+	iteracoesHashSenha = 10000
+	tamanhoSalSenha    = 16
+	tamanhoMinimoSenha = 4
+)
+
+// Limites das tentativas de senha
+const (
+	tentativasPorConta  = 5                // tentativas seguidas aceitas em cada conta
+	intervaloTentativas = 10 * time.Second // cada conta recupera uma tentativa a cada intervalo
+	hashesPorSegundo    = 20               // hashes de senha do servidor todo (Entrar e Registrar)
+)
+
+// Posicao é uma coordenada do mapa
+type Posicao struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// EstatisticasConta acumula o que o jogador fez em todas as sessões
+type EstatisticasConta struct {
+	Sessoes         int   `json:"sessoes"`
+	Movimentos      int   `json:"movimentos"`
+	Interacoes      int   `json:"interacoes"`
+	Mensagens       int   `json:"mensagens"`
+	SegundosJogados int64 `json:"segundos_jogados"`
+}
+
+// Conta é uma conta de jogador e o progresso salvo dela
+type Conta struct {
+	Nome         string            `json:"nome"`
+	Sal          string            `json:"sal"`  // hexadecimal
+	Hash         string            `json:"hash"` // PBKDF2-HMAC-SHA256 da senha, em hexadecimal
+	Criada       time.Time         `json:"criada"`
+	UltimoAcesso time.Time         `json:"ultimo_acesso"`
+	Posicao      *Posicao          `json:"posicao,omitempty"` // última posição ao sair do jogo
+	Estatisticas EstatisticasConta `json:"estatisticas"`
+}
+
+// sessaoConta liga um jogador em jogo à conta com que ele entrou
+type sessaoConta struct {
+	chave  string // chaveNome da conta
+	inicio time.Time
+}
+
+// Contas guarda as contas dos jogadores em um arquivo JSON.
+// As contas são protegidas pelo mutex do servidor; um valor nil desativa as contas.
+type Contas struct {
+	arquivo string
+	contas  map[string]*Conta // indexado por chaveNome
+	versao  uint64            // cópias do arquivo serializadas até agora
+
+	// Gravação do arquivo, feita fora do mutex do servidor
+	mutexArquivo sync.Mutex
+	gravada      uint64         // versão da última cópia gravada
+	gravacoes    sync.WaitGroup // gravações em segundo plano em andamento
+
+	// Tentativas de senha (ver permitirTentativa)
+	mutexTentativas sync.Mutex
+	tentativas      map[string]*baldeFichas // por chaveNome da conta
+	hashes          *baldeFichas            // hashes do servidor todo
+}
+
+// CarregarContas lê o arquivo de contas; se ele não existir, começa vazio
+func CarregarContas(arquivo string) (*Contas, error) {
+	c := &Contas{
+		arquivo:    arquivo,
+		contas:     make(map[string]*Conta),
+		tentativas: make(map[string]*baldeFichas),
+		hashes:     novoBalde(hashesPorSegundo, hashesPorSegundo, time.Now()),
+	}
+
+	dados, err := os.ReadFile(arquivo)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lista []*Conta
+	if err := json.Unmarshal(dados, &lista); err != nil {
+		return nil, fmt.Errorf("arquivo de contas %s inválido: %v", arquivo, err)
+	}
+	for _, conta := range lista {
+		c.contas[chaveNome(conta.Nome)] = conta
+	}
+	return c, nil
+}
+
+// existe indica se há uma conta com o nome
+func (c *Contas) existe(nome string) bool {
+	if c == nil {
+		return false
+	}
+	_, existe := c.contas[chaveNome(nome)]
+	return existe
+}
+
+// senhaCerta indica se a senha é a da conta. O sal e o hash de uma conta
+// nunca mudam, então não é preciso travar nada; o cálculo é lento.
+func senhaCerta(conta *Conta, senha string) bool {
+	sal, errSal := hex.DecodeString(conta.Sal)
+	esperado, errHash := hex.DecodeString(conta.Hash)
+	if errSal != nil || errHash != nil {
+		return false
+	}
+	return hmac.Equal(hashSenha(senha, sal), esperado)
+}
+
+// novaConta cria uma conta com o hash da senha, sem guardá-la; o cálculo é lento
+func novaConta(nome, senha string) (*Conta, error) {
+	sal := make([]byte, tamanhoSalSenha)
+	if _, err := rand.Read(sal); err != nil {
+		return nil, err
+	}
+	return &Conta{
+		Nome:   nome,
+		Sal:    hex.EncodeToString(sal),
+		Hash:   hex.EncodeToString(hashSenha(senha, sal)),
+		Criada: time.Now(),
+	}, nil
+}
+
+// permitirHash reserva o cálculo de um hash de senha no limite do servidor
+func (c *Contas) permitirHash() error {
+	c.mutexTentativas.Lock()
+	defer c.mutexTentativas.Unlock()
+
+	if !c.hashes.retirar(time.Now()) {
+		return errors.New("muitas senhas sendo conferidas agora; tente de novo em instantes")
+	}
+	return nil
+}
+
+// permitirTentativa reserva uma tentativa de senha na conta e o cálculo do
+// hash. Depois de tentativasPorConta tentativas seguidas a conta só aceita
+// uma nova a cada intervaloTentativas, mesmo com a senha certa.
+func (c *Contas) permitirTentativa(nome string) error {
+	c.mutexTentativas.Lock()
+	defer c.mutexTentativas.Unlock()
+
+	agora := time.Now()
+	chave := chaveNome(nome)
+	tentativas, existe := c.tentativas[chave]
+	if !existe {
+		tentativas = novoBalde(1/intervaloTentativas.Seconds(), tentativasPorConta, agora)
+		c.tentativas[chave] = tentativas
+	}
+	if !tentativas.retirar(agora) {
+		return fmt.Errorf("muitas tentativas de senha para %s; tente de novo em %v", nome, intervaloTentativas)
+	}
+	if !c.hashes.retirar(agora) {
+		tentativas.fichas++
+		return errors.New("muitas senhas sendo conferidas agora; tente de novo em instantes")
+	}
+	return nil
+}
+
+// senhaAceita zera as tentativas da conta depois de uma senha certa
+func (c *Contas) senhaAceita(nome string) {
+	c.mutexTentativas.Lock()
+	defer c.mutexTentativas.Unlock()
+
+	delete(c.tentativas, chaveNome(nome))
+}
+
+// serializar retorna o conteúdo do arquivo com todas as contas e a sua
+// versão, para gravar fora do mutex. Deve ser chamada com o mutex do
+// servidor travado para escrita, pois as entradas, saídas e mensagens mudam
+// as contas.
+func (c *Contas) serializar() ([]byte, uint64, error) {
+	lista := make([]*Conta, 0, len(c.contas))
+	for _, conta := range c.contas {
+		lista = append(lista, conta)
+	}
+	sort.Slice(lista, func(i, j int) bool { return lista[i].Nome < lista[j].Nome })
+	dados, err := json.MarshalIndent(lista, "", "  ")
+	if err != nil {
+		return nil, 0, err
+	}
+	c.versao++
+	return dados, c.versao, nil
+}
+
+// escrever substitui o arquivo de contas de uma vez pelo conteúdo
+// serializado, a menos que uma versão mais nova já tenha sido gravada
+func (c *Contas) escrever(dados []byte, versao uint64) error {
+	c.mutexArquivo.Lock()
+	defer c.mutexArquivo.Unlock()
+
+	if versao <= c.gravada {
+		return nil
+	}
+	temporario := c.arquivo + ".tmp"
+	if err := os.WriteFile(temporario, dados, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(temporario, c.arquivo); err != nil {
+		return err
+	}
+	c.gravada = versao
+	return nil
+}
+
+// hashSenha calcula o PBKDF2-HMAC-SHA256 da senha com o sal informado
+func hashSenha(senha string, sal []byte) []byte {
+	// Um único bloco de saída do PBKDF2 (RFC 8018), suficiente para SHA-256
+	prf := hmac.New(sha256.New, []byte(senha))
+	prf.Write(sal)
+	var indice [4]byte
+	binary.BigEndian.PutUint32(indice[:], 1)
+	prf.Write(indice[:])
+	u := prf.Sum(nil)
+
+	resultado := append([]byte{}, u...)
+	for i := 1; i < iteracoesHashSenha; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range resultado {
+			resultado[j] ^= u[j]
+		}
+	}
+	return resultado
+}
+
+// Registrar cria uma conta de jogador com nome e senha
+func (s *ServidorJogo) Registrar(args *RegistrarArgs, reply *RegistrarReply) error {
+	fim, ok := s.iniciarChamada("Registrar")
+	if !ok {
+		return errServidorEncerrado
+	}
+	defer fim()
+
+	reply.Sucesso = false
+	nome := sanitizarNome(args.Nome)
+	switch {
+	case s.contas == nil:
+		reply.Mensagem = "este servidor não tem contas de jogadores"
+		return nil
+	case nome == "":
+		reply.Mensagem = "nome inválido"
+		return nil
+	case len([]rune(args.Senha)) < tamanhoMinimoSenha:
+		reply.Mensagem = fmt.Sprintf("a senha deve ter pelo menos %d caracteres", tamanhoMinimoSenha)
+		return nil
+	}
+	existente := fmt.Sprintf("já existe uma conta com o nome %s", nome)
+
+	// O hash é calculado fora do mutex do servidor
+	s.travarLeitura()
+	existe := s.contas.existe(nome)
+	s.mutex.RUnlock()
+	if existe {
+		reply.Mensagem = existente
+		return nil
+	}
+	if err := s.contas.permitirHash(); err != nil {
+		reply.Mensagem = err.Error()
+		return nil
+	}
+	conta, err := novaConta(nome, args.Senha)
+	if err != nil {
+		reply.Mensagem = fmt.Sprintf("erro ao criar a conta: %v", err)
+		return nil
+	}
+
+	s.travar()
+	if s.contas.existe(nome) {
+		s.mutex.Unlock()
+		reply.Mensagem = existente
+		return nil
+	}
+	s.contas.contas[chaveNome(nome)] = conta
+	dados, versao, err := s.contas.serializar()
+	s.mutex.Unlock()
+
+	// A conta só existe se o arquivo for gravado
+	if err == nil {
+		err = s.contas.escrever(dados, versao)
+	}
+	if err != nil {
+		s.travar()
+		delete(s.contas.contas, chaveNome(nome))
+		s.mutex.Unlock()
+		reply.Mensagem = fmt.Sprintf("erro ao criar a conta: %v", err)
+		return nil
+	}
+
+	reply.Sucesso = true
+	reply.Nome = nome
+	reply.Mensagem = fmt.Sprintf("Conta %s criada", nome)
+	log.Printf("Conta %s criada", nome)
+	return nil
+}
+
+// autenticarConta confere a senha pedida em Entrar quando o nome é o de uma
+// conta e retorna a conta se a senha estiver certa. Roda antes de Entrar
+// travar o servidor, pois o hash é lento; a recusa de uma senha errada fica
+// com escolherNome. Retorna erro se a conta recebeu tentativas demais.
+func (s *ServidorJogo) autenticarConta(args *EntrarArgs) (*Conta, error) {
+	if s.contas == nil || args.Senha == "" {
+		return nil, nil
+	}
+
+	s.travarLeitura()
+	conta := s.contas.contas[chaveNome(sanitizarNome(args.Nome))]
+	s.mutex.RUnlock()
+	if conta == nil {
+		return nil, nil
+	}
+
+	if err := s.contas.permitirTentativa(conta.Nome); err != nil {
+		return nil, err
+	}
+	if !senhaCerta(conta, args.Senha) {
+		return nil, nil
+	}
+	s.contas.senhaAceita(conta.Nome)
+	return conta, nil
+}
+
+// posicaoDaConta retorna a posição salva da conta, se ela estiver livre.
+// Deve ser chamada com o mutex do servidor travado.
+func (s *ServidorJogo) posicaoDaConta(conta *Conta) (Posicao, bool) {
+	if conta.Posicao != nil && s.podeMoverPara(conta.Posicao.X, conta.Posicao.Y) {
+		return *conta.Posicao, true
+	}
+	return Posicao{}, false
+}
+
+// iniciarSessaoConta associa o jogador à conta e conta a sessão; chamada só
+// quando a entrada já deu certo. Deve ser chamada com o mutex do servidor
+// travado.
+func (s *ServidorJogo) iniciarSessaoConta(id int, conta *Conta) {
+	agora := time.Now()
+	conta.UltimoAcesso = agora
+	conta.Estatisticas.Sessoes++
+	s.sessoes[id] = sessaoConta{chave: chaveNome(conta.Nome), inicio: agora}
+}
+
+// restaurarPosicao coloca o jogador na posição salva da conta. Usado na
+// reprodução do registro de eventos, onde as contas não existem.
+func (s *ServidorJogo) restaurarPosicao(id int, p Posicao) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if j, existe := s.jogadores[id]; existe {
+		j.mutex.Lock()
+		s.travarTodasRegioes()
+		s.moverNaRegiao(j, p.X, p.Y)
+		s.notificar()
+		s.destravarTodasRegioes()
+		j.mutex.Unlock()
+	}
+}
+
+// contaDoJogador retorna a conta com que o jogador entrou (nil para
+// visitantes). Deve ser chamada com o mutex do servidor travado.
+func (s *ServidorJogo) contaDoJogador(id int) *Conta {
+	sessao, existe := s.sessoes[id]
+	if !existe || s.contas == nil {
+		return nil
+	}
+	return s.contas.contas[sessao.chave]
+}
+
+// encerrarSessaoConta guarda a posição, os movimentos e o tempo de jogo do
+// jogador na conta. Não grava o arquivo. Deve ser chamada com o mutex do
+// servidor travado para escrita e o do jogador travado.
+func (s *ServidorJogo) encerrarSessaoConta(j *jogadorServidor) bool {
+	id := j.info.ID
+	conta := s.contaDoJogador(id)
+	if conta == nil {
+		return false
+	}
+	conta.Posicao = &Posicao{X: j.info.PosX, Y: j.info.PosY}
+	conta.Estatisticas.Movimentos += j.movimentos
+	j.movimentos = 0
+	conta.Estatisticas.SegundosJogados += int64(time.Since(s.sessoes[id].inicio).Seconds())
+	conta.UltimoAcesso = time.Now()
+	delete(s.sessoes, id)
+	return true
+}
+
+// gravarContas copia as contas e grava o arquivo em segundo plano,
+// registrando erros no log. Deve ser chamada com o mutex do servidor travado
+// para escrita.
+func (s *ServidorJogo) gravarContas() {
+	if s.contas == nil {
+		return
+	}
+	dados, versao, err := s.contas.serializar()
+	if err != nil {
+		log.Printf("Erro ao gravar contas: %v", err)
+		return
+	}
+	s.contas.gravacoes.Add(1)
+	go func() {
+		defer s.contas.gravacoes.Done()
+		if err := s.contas.escrever(dados, versao); err != nil {
+			log.Printf("Erro ao gravar contas: %v", err)
+		}
+	}()
+}
+
+// salvarProgresso encerra as sessões de todos os jogadores com conta e grava
+// o arquivo de contas. Usado no encerramento do servidor.
+func (s *ServidorJogo) salvarProgresso() {
+	s.mutex.Lock()
+	salvou := false
+	for id := range s.sessoes {
+		j, existe := s.jogadores[id]
+		if !existe {
+			continue
+		}
+		j.mutex.Lock()
+		if s.encerrarSessaoConta(j) {
+			salvou = true
+		}
+		j.mutex.Unlock()
+	}
+	if salvou {
+		s.gravarContas()
+	}
+	s.mutex.Unlock()
+
+	if s.contas != nil {
+		s.contas.gravacoes.Wait()
+	}
+	if salvou {
+		log.Println("Progresso das contas gravado em:", s.contas.arquivo)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// servidorComContas cria um servidor com o arquivo de contas em um diretório
+// temporário e a conta ana
+func servidorComContas(t *testing.T, mapa string) *ServidorJogo {
+	t.Helper()
+	s, err := prepararServidor(OpcoesServidor{Mapa: mapa, ArquivoContas: filepath.Join(t.TempDir(), "contas.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := RegistrarReply{}
+	s.Registrar(&RegistrarArgs{Nome: "ana", Senha: "segredo"}, &reply)
+	if !reply.Sucesso {
+		t.Fatal(reply.Mensagem)
+	}
+	return s
+}
+
+func TestRegistrarGravaConta(t *testing.T) {
+	s := servidorComContas(t, "mapa.txt")
+	dados, err := os.ReadFile(s.contas.arquivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dados), `"nome": "ana"`) || strings.Contains(string(dados), "segredo") {
+		t.Fatalf("arquivo de contas inesperado:\n%s", dados)
+	}
+
+	reply := RegistrarReply{}
+	s.Registrar(&RegistrarArgs{Nome: "Ana", Senha: "outra-senha"}, &reply)
+	if reply.Sucesso {
+		t.Fatal("conta registrada duas vezes")
+	}
+}
+
+func TestLoginLimitaTentativas(t *testing.T) {
+	s := servidorComContas(t, "mapa.txt")
+	entrar := func(senha string) EntrarReply {
+		reply := EntrarReply{}
+		s.Entrar(&EntrarArgs{Nome: "ana", Simbolo: 'A', Senha: senha}, &reply)
+		return reply
+	}
+
+	for i := 0; i < tentativasPorConta; i++ {
+		if reply := entrar("errada"); reply.Sucesso || !strings.Contains(reply.Mensagem, "senha correta") {
+			t.Fatalf("tentativa %d: %+v", i+1, reply)
+		}
+	}
+	// Esgotadas as tentativas, nem a senha certa é conferida
+	if reply := entrar("segredo"); reply.Sucesso || !strings.Contains(reply.Mensagem, "muitas tentativas") {
+		t.Fatalf("tentativa além do limite: %+v", reply)
+	}
+
+	// Outra conta não é afetada
+	registro := RegistrarReply{}
+	s.Registrar(&RegistrarArgs{Nome: "bia", Senha: "segredo"}, &registro)
+	reply := EntrarReply{}
+	s.Entrar(&EntrarArgs{Nome: "bia", Simbolo: 'B', Senha: "segredo"}, &reply)
+	if !reply.Sucesso {
+		t.Fatalf("bia não entrou: %s", reply.Mensagem)
+	}
+}
+
+func TestEntradaRecusadaNaoContaSessao(t *testing.T) {
+	// Mapa com uma única célula livre
+	mapa := filepath.Join(t.TempDir(), "mapa.txt")
+	if err := os.WriteFile(mapa, []byte("▤▤▤\n▤ ▤\n▤▤▤\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := servidorComContas(t, mapa)
+	visitante := entrarTeste(t, s, "visitante", 'V')
+
+	reply := EntrarReply{}
+	s.Entrar(&EntrarArgs{Nome: "ana", Simbolo: 'A', Senha: "segredo"}, &reply)
+	if reply.Sucesso {
+		t.Fatal("ana entrou sem posição livre")
+	}
+	conta := s.contas.contas["ana"]
+	if conta.Estatisticas.Sessoes != 0 || !conta.UltimoAcesso.IsZero() || len(s.sessoes) != 0 {
+		t.Fatalf("entrada recusada contou uma sessão: %+v", conta)
+	}
+
+	// A entrada recusada não gasta um ID
+	s.Sair(&SairArgs{JogadorID: visitante, Sessao: s.sessaoDe(visitante)}, &SairReply{})
+	reply = EntrarReply{}
+	s.Entrar(&EntrarArgs{Nome: "ana", Simbolo: 'A', Senha: "segredo"}, &reply)
+	if !reply.Sucesso || reply.JogadorID != visitante+1 || conta.Estatisticas.Sessoes != 1 {
+		t.Fatalf("entrada de ana: %+v, sessões %d", reply, conta.Estatisticas.Sessoes)
+	}
+}
@@ -0,0 +1,140 @@
+// encerramento.go - Encerramento gracioso do servidor
+// Ao receber o pedido de parada o servidor deixa de aceitar conexões, avisa os
+// jogadores com uma contagem regressiva, espera as chamadas RPC em andamento,
+// grava um snapshot final e fecha as conexões restantes.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+// MensagemServidorEncerrado é o texto do erro devolvido às chamadas feitas após o encerramento
+const MensagemServidorEncerrado = "servidor encerrado"
+
+var errServidorEncerrado = errors.New(MensagemServidorEncerrado)
+
+// iniciarChamada registra uma chamada RPC em andamento. Retorna a função que
+// deve ser chamada ao final dela, ou false se o servidor já foi encerrado.
+// A duração da chamada é contabilizada nas métricas do método.
+func (s *ServidorJogo) iniciarChamada(metodo string) (func(), bool) {
+	s.controle.Lock()
+	defer s.controle.Unlock()
+
+	if s.encerrado {
+		return nil, false
+	}
+	s.emAndamento++
+	inicio := time.Now()
+
+	return func() {
+		s.metricas.registrarChamada(metodo, time.Since(inicio))
+
+		s.controle.Lock()
+		defer s.controle.Unlock()
+
+		s.emAndamento--
+		if s.emAndamento == 0 {
+			s.semChamadas.Broadcast()
+		}
+	}, true
+}
+
+// aguardarChamadas recusa novas chamadas e espera as que estão em andamento
+func (s *ServidorJogo) aguardarChamadas() {
+	s.controle.Lock()
+	defer s.controle.Unlock()
+
+	s.encerrado = true
+	for s.emAndamento > 0 {
+		s.semChamadas.Wait()
+	}
+}
+
+// adicionarConexao passa a acompanhar uma conexão aberta; retorna false se o
+// servidor já foi encerrado
+func (s *ServidorJogo) adicionarConexao(conn net.Conn) bool {
+	s.controle.Lock()
+	defer s.controle.Unlock()
+
+	if s.encerrado {
+		return false
+	}
+	s.conexoes[conn] = struct{}{}
+	return true
+}
+
+// removerConexao deixa de acompanhar uma conexão encerrada
+func (s *ServidorJogo) removerConexao(conn net.Conn) {
+	s.controle.Lock()
+	defer s.controle.Unlock()
+
+	delete(s.conexoes, conn)
+}
+
+// fecharConexoes fecha todas as conexões ainda abertas
+func (s *ServidorJogo) fecharConexoes() {
+	s.controle.Lock()
+	defer s.controle.Unlock()
+
+	for conn := range s.conexoes {
+		conn.Close()
+	}
+}
+
+// anunciarEncerramento avisa os jogadores, a cada segundo, quanto falta para o encerramento
+func (s *ServidorJogo) anunciarEncerramento(contagem time.Duration) {
+	for restante := int(contagem.Seconds()); restante > 0; restante-- {
+		s.mutex.Lock()
+		s.estado.Encerrando = true
+		s.estado.SegundosParaEncerrar = restante
+		s.estado.Mensagens = append(s.estado.Mensagens,
+			fmt.Sprintf("Servidor será encerrado em %d s", restante))
+		s.notificar()
+		s.mutex.Unlock()
+
+		time.Sleep(time.Second)
+	}
+
+	s.mutex.Lock()
+	s.estado.Encerrando = true
+	s.estado.SegundosParaEncerrar = 0
+	s.estado.Mensagens = append(s.estado.Mensagens, "Servidor encerrado")
+	s.notificar()
+	s.mutex.Unlock()
+}
+
+// salvarSnapshot grava o estado atual do servidor em um arquivo JSON
+func (s *ServidorJogo) salvarSnapshot(nome string) error {
+	dados, err := json.MarshalIndent(s.instantaneo(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(nome, dados, 0644)
+}
+
+// encerrar executa as etapas do encerramento gracioso
+func (s *ServidorJogo) encerrar(opcoes OpcoesServidor) {
+	s.anunciarEncerramento(opcoes.Contagem)
+
+	s.aguardarChamadas()
+	log.Println("Chamadas em andamento concluídas")
+
+	s.salvarProgresso()
+
+	if opcoes.Snapshot != "" {
+		if err := s.salvarSnapshot(opcoes.Snapshot); err != nil {
+			log.Printf("Erro ao gravar snapshot: %v", err)
+		} else {
+			log.Println("Snapshot gravado em:", opcoes.Snapshot)
+		}
+	}
+
+	s.fecharConexoes()
+	log.Println("Servidor encerrado")
+}
@@ -0,0 +1,350 @@
+// eventos.go - Registro de eventos (append-only) e reprodução determinística
+// Cada comando aceito e cada evento do servidor é gravado como uma linha JSON
+// no arquivo de registro. O modo "replay" lê esse arquivo e aplica os eventos,
+// na mesma ordem, a um ServidorJogo novo, reproduzindo o estado final.
+// Quem registra um evento não espera o disco: os eventos passam por uma fila
+// até uma goroutine que os grava em ordem de tick.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tipos de evento gravados no registro
+const (
+	EventoInicio    = "inicio"
+	EventoEntrar    = "entrar"
+	EventoMover     = "mover"
+	EventoInteragir = "interagir"
+	EventoChat      = "chat"
+	EventoSair      = "sair"
+	EventoExpulsar  = "expulsar" // o servidor expulsou o jogador pelos limites de comandos
+)
+
+// Evento representa uma linha do registro de eventos
+type Evento struct {
+	Tick      uint64             `json:"tick"`
+	Horario   time.Time          `json:"horario"`
+	Tipo      string             `json:"tipo"`
+	JogadorID int                `json:"jogador"`
+	Mapa      string             `json:"mapa,omitempty"`    // apenas em "inicio"
+	Entrar    *EntrarArgs        `json:"entrar,omitempty"`  // apenas em "entrar"
+	Posicao   *Posicao           `json:"posicao,omitempty"` // em "entrar", posição restaurada da conta
+	Comando   *EnviarComandoArgs `json:"comando,omitempty"` // comandos do jogador
+	Motivo    string             `json:"motivo,omitempty"`  // apenas em "expulsar"
+}
+
+// Quantidade de eventos que podem esperar na fila do registro; com a fila
+// cheia, quem registra espera a gravação
+const tamanhoFilaRegistro = 4096
+
+// RegistroEventos grava eventos em um arquivo aberto apenas para acréscimo
+type RegistroEventos struct {
+	arquivo   *os.File
+	eventos   chan Evento   // fila até a goroutine de gravação
+	parar     chan struct{} // fechado por Fechar
+	terminado chan struct{} // fechado quando a goroutine de gravação termina
+	fechar    sync.Once
+	errFechar error
+}
+
+// NovoRegistroEventos abre (ou cria) o arquivo de registro para acréscimo e
+// inicia a goroutine que grava os eventos
+func NovoRegistroEventos(nome string) (*RegistroEventos, error) {
+	arq, err := os.OpenFile(nome, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	r := &RegistroEventos{
+		arquivo:   arq,
+		eventos:   make(chan Evento, tamanhoFilaRegistro),
+		parar:     make(chan struct{}),
+		terminado: make(chan struct{}),
+	}
+	go r.gravarFila()
+	return r, nil
+}
+
+// Gravar coloca um evento na fila de gravação; eventos gravados depois de
+// Fechar são descartados
+func (r *RegistroEventos) Gravar(ev Evento) error {
+	select {
+	case r.eventos <- ev:
+		return nil
+	case <-r.terminado:
+		return fmt.Errorf("registro de eventos fechado")
+	}
+}
+
+// gravarFila grava os eventos da fila no arquivo até Fechar ser chamada.
+// Os eventos chegam fora de ordem quando jogadores em regiões diferentes se
+// movem ao mesmo tempo, então cada um espera até que todos os ticks
+// anteriores tenham sido gravados. O primeiro evento recebido, o "inicio" de
+// ativarRegistro, define o primeiro tick. O buffer é descarregado sempre que
+// a fila esvazia.
+func (r *RegistroEventos) gravarFila() {
+	defer close(r.terminado)
+
+	saida := bufio.NewWriter(r.arquivo)
+	codif := json.NewEncoder(saida)
+	pendentes := make(map[uint64]Evento)
+	var proximo uint64
+	escrever := func(ev Evento) {
+		if err := codif.Encode(ev); err != nil {
+			log.Printf("Erro ao gravar evento no registro: %v", err)
+		}
+	}
+	receber := func(ev Evento) {
+		if proximo == 0 {
+			proximo = ev.Tick
+		}
+		pendentes[ev.Tick] = ev
+		for {
+			ev, existe := pendentes[proximo]
+			if !existe {
+				return
+			}
+			delete(pendentes, proximo)
+			proximo++
+			escrever(ev)
+		}
+	}
+	descarregar := func() {
+		if err := saida.Flush(); err != nil {
+			log.Printf("Erro ao gravar evento no registro: %v", err)
+		}
+	}
+
+	for {
+		select {
+		case ev := <-r.eventos:
+			receber(ev)
+			continue
+		default:
+		}
+
+		descarregar()
+		select {
+		case ev := <-r.eventos:
+			receber(ev)
+		case <-r.parar:
+			for {
+				select {
+				case ev := <-r.eventos:
+					receber(ev)
+					continue
+				default:
+				}
+				break
+			}
+
+			// Ticks que ficaram esperando um anterior que nunca chegou são
+			// gravados assim mesmo, em ordem
+			ticks := make([]uint64, 0, len(pendentes))
+			for tick := range pendentes {
+				ticks = append(ticks, tick)
+			}
+			sort.Slice(ticks, func(i, k int) bool { return ticks[i] < ticks[k] })
+			for _, tick := range ticks {
+				escrever(pendentes[tick])
+			}
+			descarregar()
+			return
+		}
+	}
+}
+
+// Fechar grava os eventos que ainda estão na fila e fecha o arquivo de
+// registro
+func (r *RegistroEventos) Fechar() error {
+	r.fechar.Do(func() {
+		close(r.parar)
+		<-r.terminado
+		r.errFechar = r.arquivo.Close()
+	})
+	return r.errFechar
+}
+
+// ativarRegistro passa a gravar os eventos do servidor no arquivo informado.
+// Deve ser chamada antes de o servidor começar a receber chamadas.
+func (s *ServidorJogo) ativarRegistro(nome string) error {
+	registro, err := NovoRegistroEventos(nome)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.registro = registro
+	s.registrar(Evento{Tipo: EventoInicio, JogadorID: -1, Mapa: s.mapaFile})
+	return nil
+}
+
+// registrar atribui tick e horário ao evento e o coloca na fila do registro,
+// se ativo. Deve ser chamada com o que ordena o evento em relação aos que
+// dependem dele ainda travado: o mutex do servidor nas entradas, saídas e
+// mensagens; o jogador e as regiões do movimento nos movimentos (ver
+// regioes.go). Assim, eventos que dependem um do outro recebem ticks na
+// ordem em que aconteceram, e eventos com ticks trocados entre si não
+// dependem um do outro.
+func (s *ServidorJogo) registrar(ev Evento) {
+	ev.Tick = atomic.AddUint64(&s.tick, 1)
+	if s.registro == nil {
+		return
+	}
+
+	ev.Horario = time.Now()
+	if err := s.registro.Gravar(ev); err != nil {
+		log.Printf("Erro ao gravar evento no registro: %v", err)
+	}
+}
+
+// lerEventos carrega todos os eventos de um arquivo de registro
+func lerEventos(nome string) ([]Evento, error) {
+	arq, err := os.Open(nome)
+	if err != nil {
+		return nil, err
+	}
+	defer arq.Close()
+
+	var eventos []Evento
+	scanner := bufio.NewScanner(arq)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	linha := 0
+	for scanner.Scan() {
+		linha++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var ev Evento
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("linha %d: %v", linha, err)
+		}
+		eventos = append(eventos, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return eventos, nil
+}
+
+// reproduzirEventos aplica os eventos do registro a um servidor novo e o retorna.
+// Um evento "inicio" (reinício do servidor) descarta o estado anterior.
+// mapaPadrao é usado se o registro não começar com um evento "inicio".
+func reproduzirEventos(nome, mapaPadrao string) (*ServidorJogo, error) {
+	eventos, err := lerEventos(nome)
+	if err != nil {
+		return nil, err
+	}
+
+	servidor, err := NovoServidor(mapaPadrao)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ev := range eventos {
+		switch ev.Tipo {
+		case EventoInicio:
+			mapa := ev.Mapa
+			if mapa == "" {
+				mapa = mapaPadrao
+			}
+			if servidor, err = NovoServidor(mapa); err != nil {
+				return nil, fmt.Errorf("tick %d: %v", ev.Tick, err)
+			}
+			servidor.tick = ev.Tick
+
+		case EventoEntrar:
+			if ev.Entrar == nil {
+				return nil, fmt.Errorf("tick %d: evento entrar sem argumentos", ev.Tick)
+			}
+			reply := EntrarReply{}
+			servidor.Entrar(ev.Entrar, &reply)
+			if !reply.Sucesso || reply.JogadorID != ev.JogadorID {
+				return nil, fmt.Errorf("tick %d: divergência ao reproduzir entrada do jogador %d (obtido %d: %s)",
+					ev.Tick, ev.JogadorID, reply.JogadorID, reply.Mensagem)
+			}
+			if ev.Posicao != nil {
+				servidor.restaurarPosicao(ev.JogadorID, *ev.Posicao)
+			}
+
+		case EventoSair:
+			reply := SairReply{}
+			servidor.Sair(&SairArgs{JogadorID: ev.JogadorID, Sessao: servidor.sessaoDe(ev.JogadorID)}, &reply)
+			if !reply.Sucesso {
+				return nil, fmt.Errorf("tick %d: divergência ao reproduzir saída: %s", ev.Tick, reply.Mensagem)
+			}
+
+		case EventoExpulsar:
+			if !servidor.expulsarPorID(ev.JogadorID, ev.Motivo) {
+				return nil, fmt.Errorf("tick %d: divergência ao reproduzir expulsão do jogador %d, que não está no jogo", ev.Tick, ev.JogadorID)
+			}
+
+		default:
+			if ev.Comando == nil {
+				return nil, fmt.Errorf("tick %d: evento %q sem comando", ev.Tick, ev.Tipo)
+			}
+			// A chave da sessão não é gravada; vale a do servidor novo
+			reply := EnviarComandoReply{}
+			ev.Comando.Sessao = servidor.sessaoDe(ev.Comando.JogadorID)
+			servidor.EnviarComando(ev.Comando, &reply)
+			if !reply.Sucesso {
+				return nil, fmt.Errorf("tick %d: divergência ao reproduzir comando: %s", ev.Tick, reply.Mensagem)
+			}
+		}
+
+		if ev.Tick != 0 && servidor.tick != ev.Tick {
+			return nil, fmt.Errorf("tick %d: reprodução chegou ao tick %d", ev.Tick, servidor.tick)
+		}
+	}
+
+	return servidor, nil
+}
+
+// Instantaneo é uma fotografia do estado dinâmico do servidor (o mapa é estático
+// e fica de fora). Usado na saída do replay e no snapshot do encerramento.
+type Instantaneo struct {
+	Tick      uint64        `json:"tick"`
+	Mapa      string        `json:"mapa"`
+	Jogadores []JogadorInfo `json:"jogadores"`
+	Mensagens []string      `json:"mensagens"`
+}
+
+// instantaneo captura o estado atual do servidor
+func (s *ServidorJogo) instantaneo() Instantaneo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	// Jogadores ordenados por ID para que a saída seja comparável entre
+	// execuções, e sem o RTT, que é telemetria e não passa pelo registro
+	estado := s.copiarEstado()
+	jogadores := make([]JogadorInfo, 0, len(estado.Jogadores))
+	for _, j := range estado.Jogadores {
+		j.RTT = 0
+		jogadores = append(jogadores, j)
+	}
+	sort.Slice(jogadores, func(i, k int) bool { return jogadores[i].ID < jogadores[k].ID })
+
+	return Instantaneo{Tick: atomic.LoadUint64(&s.tick), Mapa: s.mapaFile, Jogadores: jogadores, Mensagens: estado.Mensagens}
+}
+
+// ExecutarReplay reproduz um registro de eventos e imprime o estado final em JSON
+func ExecutarReplay(nome, mapaPadrao string) error {
+	servidor, err := reproduzirEventos(nome, mapaPadrao)
+	if err != nil {
+		return err
+	}
+
+	codif := json.NewEncoder(os.Stdout)
+	codif.SetIndent("", "  ")
+	return codif.Encode(servidor.instantaneo())
+}
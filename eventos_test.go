@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReplayReproduzEstado(t *testing.T) {
+	arquivo := filepath.Join(t.TempDir(), "eventos.log")
+	s, err := prepararServidor(OpcoesServidor{Mapa: "mapa.txt", ArquivoEventos: arquivo})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ana := entrarTeste(t, s, "ana", 'A')
+	bia := entrarTeste(t, s, "bia", 'B')
+	caio := entrarTeste(t, s, "caio", 'C')
+
+	direcoes := []Direcao{DirecaoDireita, DirecaoBaixo, DirecaoDireita, DirecaoCima, DirecaoEsquerda}
+	for i, direcao := range direcoes {
+		comandoTeste(t, s, EnviarComandoArgs{JogadorID: ana, Comando: NovoComandoMover(direcao), Sequencia: uint64(i + 1)})
+		comandoTeste(t, s, EnviarComandoArgs{JogadorID: bia, Comando: NovoComandoMover(direcao)})
+	}
+	comandoTeste(t, s, EnviarComandoArgs{JogadorID: bia, Comando: NovoComandoChat("olá"), Sequencia: 7})
+	comandoTeste(t, s, EnviarComandoArgs{JogadorID: caio, Comando: NovoComandoInteragir()})
+	s.Ping(&PingArgs{JogadorID: ana, Sessao: s.sessaoDe(ana), RTT: 42 * time.Millisecond}, &PingReply{})
+	s.Ping(&PingArgs{JogadorID: bia, Sessao: s.sessaoDe(bia), RTT: 7 * time.Millisecond}, &PingReply{})
+	s.Sair(&SairArgs{JogadorID: caio, Sessao: s.sessaoDe(caio)}, &SairReply{})
+	s.registro.Fechar()
+
+	reproduzido, err := reproduzirEventos(arquivo, "mapa.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, copia := s.instantaneo(), reproduzido.instantaneo()
+	if !reflect.DeepEqual(original, copia) {
+		t.Fatalf("o replay divergiu do servidor:\noriginal %+v\nreplay   %+v", original, copia)
+	}
+	if jogador := copia.Jogadores[0]; jogador.UltimaSequencia != uint64(len(direcoes)) {
+		t.Fatalf("replay de ana sem sequência: %+v", jogador)
+	}
+}
+
+func TestEnviarComandoArgsJSON(t *testing.T) {
+	args := EnviarComandoArgs{JogadorID: 3, Comando: NovoComandoChat("oi"), Sequencia: 9}
+	dados, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lido EnviarComandoArgs
+	if err := json.Unmarshal(dados, &lido); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lido, args) {
+		t.Fatalf("lido %+v, gravado %+v", lido, args)
+	}
+
+	// Formato anterior aos comandos tipados
+	legado := `{"JogadorID": 2, "Tipo": "mover", "Tecla": 100}`
+	if err := json.Unmarshal([]byte(legado), &lido); err != nil {
+		t.Fatal(err)
+	}
+	esperado := EnviarComandoArgs{JogadorID: 2, Comando: NovoComandoMover(DirecaoDireita)}
+	if !reflect.DeepEqual(lido, esperado) {
+		t.Fatalf("legado lido como %+v, esperado %+v", lido, esperado)
+	}
+}
+
+func TestReplayReproduzExpulsao(t *testing.T) {
+	arquivo := filepath.Join(t.TempDir(), "eventos.log")
+	s, err := prepararServidor(OpcoesServidor{Mapa: "mapa.txt", ArquivoEventos: arquivo})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ana := entrarTeste(t, s, "ana", 'A')
+	bia := entrarTeste(t, s, "bia", 'B')
+	comandoTeste(t, s, EnviarComandoArgs{JogadorID: bia, Comando: NovoComandoMover(DirecaoDireita)})
+	if !s.expulsarPorID(bia, motivoExcessoComandos) {
+		t.Fatal("bia não estava no jogo")
+	}
+	comandoTeste(t, s, EnviarComandoArgs{JogadorID: ana, Comando: NovoComandoChat("tchau, bia")})
+	s.registro.Fechar()
+
+	reproduzido, err := reproduzirEventos(arquivo, "mapa.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, copia := s.instantaneo(), reproduzido.instantaneo()
+	if !reflect.DeepEqual(original, copia) {
+		t.Fatalf("o replay divergiu do servidor:\noriginal %+v\nreplay   %+v", original, copia)
+	}
+	esperado := "Você foi expulso do jogo por " + motivoExcessoComandos
+	reproduzido.travarLeitura()
+	mensagem := reproduzido.jogadorAusente(bia)
+	reproduzido.mutex.RUnlock()
+	if mensagem != esperado {
+		t.Fatalf("bia no replay: %q, esperado %q", mensagem, esperado)
+	}
+}
@@ -0,0 +1,498 @@
+// falhas.go - Falhas de rede simuladas nas conexões
+// Para ver o jogo em uma rede ruim sem precisar de uma, as conexões do
+// cliente (NovoCliente, o modo offline) e as aceitas pelo servidor podem
+// passar por um transporte que atrasa os dados (latência e variação), limita
+// a banda, trava a conexão por um tempo ou a derruba, com sorteios
+// reproduzíveis a partir de uma semente. As opções de linha de comando ficam
+// em registrarFlagsFalhas e valem para o jogo, o roteiro e a carga.
+//
+// Cada trecho escrito ou lido é um pacote: ele é entregue do outro lado
+// depois do tempo de transmissão (com -banda), da latência e da variação,
+// sem nunca passar à frente de um pacote anterior, como em TCP.
+package main
+
+import (
+	"errors"
+	"flag"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConfigFalhas descreve as falhas de rede simuladas em cada sentido de uma
+// conexão. O valor zero não simula nenhuma falha.
+type ConfigFalhas struct {
+	Latencia          time.Duration // atraso fixo de cada pacote
+	Variacao          time.Duration // atraso adicional sorteado entre 0 e Variacao (jitter)
+	Banda             int           // bytes por segundo (0 para banda ilimitada)
+	Desconexao        float64       // probabilidade de derrubar a conexão a cada pacote
+	Travamento        float64       // probabilidade de travar a conexão a cada pacote
+	DuracaoTravamento time.Duration // por quanto tempo a conexão fica travada
+	Semente           int64         // semente dos sorteios (0 usa o relógio)
+}
+
+// Ativa indica se a configuração simula alguma falha
+func (f ConfigFalhas) Ativa() bool {
+	return f.Latencia > 0 || f.Variacao > 0 || f.Banda > 0 || f.Desconexao > 0 ||
+		(f.Travamento > 0 && f.DuracaoTravamento > 0)
+}
+
+// Falhas simuladas nas conexões abertas pelo cliente, definidas pelas opções
+// de linha de comando
+var falhasCliente ConfigFalhas
+
+// Conexões criadas com falhas; cada uma usa a semente somada ao seu número,
+// para que a mesma sequência de conexões repita os mesmos sorteios
+var contadorConexoesFalhas int64
+
+// errConexaoDerrubada é o erro das conexões derrubadas de propósito
+var errConexaoDerrubada = errors.New("conexão derrubada (falha simulada)")
+
+// registrarFlagsFalhas registra as opções de falhas de rede no conjunto de
+// opções e retorna a configuração que elas preenchem
+func registrarFlagsFalhas(fs *flag.FlagSet) *ConfigFalhas {
+	f := &ConfigFalhas{}
+	fs.DurationVar(&f.Latencia, "latencia", 0, "Falha simulada: latência em cada sentido das conexões, ex. 100ms")
+	fs.DurationVar(&f.Variacao, "variacao", 0, "Falha simulada: variação aleatória da latência (jitter), ex. 50ms")
+	fs.IntVar(&f.Banda, "banda", 0, "Falha simulada: banda em bytes por segundo em cada sentido (0 sem limite)")
+	fs.Float64Var(&f.Desconexao, "prob-desconexao", 0, "Falha simulada: probabilidade de derrubar a conexão a cada pacote, ex. 0.001")
+	fs.Float64Var(&f.Travamento, "prob-travamento", 0, "Falha simulada: probabilidade de travar a conexão a cada pacote")
+	fs.DurationVar(&f.DuracaoTravamento, "travamento", 2*time.Second, "Falha simulada: duração de cada travamento")
+	fs.Int64Var(&f.Semente, "semente-falhas", 0, "Semente dos sorteios das falhas simuladas (0 usa o relógio)")
+	return f
+}
+
+// comFalhas envolve a conexão com as falhas configuradas, se houver alguma
+func comFalhas(conn net.Conn, falhas ConfigFalhas) net.Conn {
+	if !falhas.Ativa() {
+		return conn
+	}
+	return novaConexaoComFalhas(conn, falhas)
+}
+
+// ouvinteComFalhas aplica as falhas a cada conexão aceita
+type ouvinteComFalhas struct {
+	net.Listener
+	falhas ConfigFalhas
+}
+
+// ouvirComFalhas envolve o listener para que as conexões aceitas tenham as
+// falhas configuradas, se houver alguma
+func ouvirComFalhas(l net.Listener, falhas ConfigFalhas) net.Listener {
+	if !falhas.Ativa() {
+		return l
+	}
+	return &ouvinteComFalhas{Listener: l, falhas: falhas}
+}
+
+func (l *ouvinteComFalhas) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return novaConexaoComFalhas(conn, l.falhas), nil
+}
+
+// pacoteAtrasado é um trecho de dados que só pode ser entregue em entrega
+type pacoteAtrasado struct {
+	dados   []byte
+	erro    error
+	entrega time.Time
+}
+
+// sentidoFalhas calcula quando cada pacote de um sentido da conexão é
+// entregue. Cada sentido tem seus próprios sorteios, que assim não dependem
+// da ordem em que as goroutines dos dois sentidos rodam.
+type sentidoFalhas struct {
+	mutex   sync.Mutex
+	falhas  ConfigFalhas
+	sorteio *rand.Rand
+	livre   time.Time // quando o "fio" termina de transmitir o último pacote
+	ultima  time.Time // entrega do último pacote, que o próximo não ultrapassa
+}
+
+// agendar retorna o horário de entrega de um pacote de n bytes e se a
+// conexão deve ser derrubada no lugar dele
+func (s *sentidoFalhas) agendar(n int) (time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f := s.falhas
+	if f.Desconexao > 0 && s.sorteio.Float64() < f.Desconexao {
+		return time.Time{}, true
+	}
+
+	agora := time.Now()
+	if s.livre.Before(agora) {
+		s.livre = agora
+	}
+	if f.Banda > 0 {
+		s.livre = s.livre.Add(time.Duration(n) * time.Second / time.Duration(f.Banda))
+	}
+	entrega := s.livre.Add(f.Latencia)
+	if f.Variacao > 0 {
+		entrega = entrega.Add(time.Duration(s.sorteio.Int63n(int64(f.Variacao) + 1)))
+	}
+	if f.Travamento > 0 && s.sorteio.Float64() < f.Travamento {
+		entrega = entrega.Add(f.DuracaoTravamento)
+	}
+	if entrega.Before(s.ultima) {
+		entrega = s.ultima
+	}
+	s.ultima = entrega
+	return entrega, false
+}
+
+// Tempo que Close espera, depois do horário de entrega de cada pacote ainda
+// na fila, para que a conexão real o aceite antes de desistir e fechá-la
+const prazoEsvaziar = 5 * time.Second
+
+// prazos guarda os prazos de leitura e escrita definidos com SetDeadline.
+// Eles não são repassados à conexão real: os pacotes atrasados são escritos
+// e lidos nela depois, e um prazo de quem chamou Write ou Read não pode
+// derrubar a entrega de dados que já foram aceitos.
+type prazos struct {
+	mutex   sync.Mutex
+	leitura time.Time
+	escrita time.Time
+	mudou   chan struct{} // fechado e trocado a cada mudança, para acordar quem espera
+}
+
+// definir troca os prazos informados (nil mantém o atual)
+func (p *prazos) definir(leitura, escrita *time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if leitura != nil {
+		p.leitura = *leitura
+	}
+	if escrita != nil {
+		p.escrita = *escrita
+	}
+	close(p.mudou)
+	p.mudou = make(chan struct{})
+}
+
+// atual retorna o prazo de leitura ou de escrita e um canal fechado quando
+// os prazos mudarem
+func (p *prazos) atual(escrita bool) (time.Time, <-chan struct{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if escrita {
+		return p.escrita, p.mudou
+	}
+	return p.leitura, p.mudou
+}
+
+// vencimento retorna um canal que recebe quando o prazo vencer (nil se não
+// houver prazo) e a função que libera o temporizador
+func vencimento(prazo time.Time) (<-chan time.Time, func() bool) {
+	if prazo.IsZero() {
+		return nil, func() bool { return false }
+	}
+	temporizador := time.NewTimer(time.Until(prazo))
+	return temporizador.C, temporizador.Stop
+}
+
+// vencido indica se o prazo já passou
+func vencido(prazo time.Time) bool {
+	return !prazo.IsZero() && !time.Now().Before(prazo)
+}
+
+// conexaoComFalhas atrasa, trava e derruba uma conexão, mantendo a ordem dos
+// dados. Quem escreve não espera: os dados são enviados depois. Close não
+// descarta o que Write já aceitou: os pacotes da fila são entregues nos seus
+// horários e só então a conexão real é fechada. Uma queda simulada, ao
+// contrário, descarta a fila, e as chamadas seguintes devolvem
+// errConexaoDerrubada.
+type conexaoComFalhas struct {
+	net.Conn
+
+	envio    *sentidoFalhas // usado por Write
+	recepcao *sentidoFalhas // usado pela goroutine receber
+	prazos   prazos
+
+	escrita  chan pacoteAtrasado
+	leitura  chan pacoteAtrasado
+	proximo  *pacoteAtrasado // pacote recebido por Read, esperando o seu horário
+	restante []byte          // dados do último pacote lido que não couberam em Read
+	erro     error           // erro de leitura, devolvido depois dos dados
+
+	// escrevendo é travado para leitura por Write enquanto coloca um pacote
+	// na fila; encerrar o trava para escrita para saber que nenhum outro
+	// pacote entrará nela
+	escrevendo sync.RWMutex
+
+	fechada   chan struct{} // Close ou queda: Read e Write passam a falhar
+	esvaziar  chan struct{} // Close: enviar entrega a fila e fecha a conexão real
+	derrubada chan struct{} // queda: a fila é descartada
+	motivo    error         // erro devolvido depois de fechada
+	fechar    sync.Once
+}
+
+// novaConexaoComFalhas envolve a conexão com as falhas informadas
+func novaConexaoComFalhas(conn net.Conn, falhas ConfigFalhas) *conexaoComFalhas {
+	semente := falhas.Semente
+	if semente == 0 {
+		semente = time.Now().UnixNano()
+	}
+	numero := atomic.AddInt64(&contadorConexoesFalhas, 1)
+	semente += 2 * numero
+
+	c := &conexaoComFalhas{
+		Conn:      conn,
+		envio:     &sentidoFalhas{falhas: falhas, sorteio: rand.New(rand.NewSource(semente))},
+		recepcao:  &sentidoFalhas{falhas: falhas, sorteio: rand.New(rand.NewSource(semente + 1))},
+		prazos:    prazos{mudou: make(chan struct{})},
+		escrita:   make(chan pacoteAtrasado, 1024),
+		leitura:   make(chan pacoteAtrasado, 1024),
+		fechada:   make(chan struct{}),
+		esvaziar:  make(chan struct{}),
+		derrubada: make(chan struct{}),
+	}
+	go c.enviar()
+	go c.receber()
+	return c
+}
+
+// encerrar fecha a conexão para Read e Write, com o erro motivo. Com
+// esvaziar, os pacotes já aceitos por Write ainda são entregues; senão são
+// descartados e a conexão real é fechada na hora. Retorna false se a conexão
+// já estava fechada.
+func (c *conexaoComFalhas) encerrar(motivo error, esvaziar bool) bool {
+	encerrou := false
+	c.fechar.Do(func() {
+		encerrou = true
+		c.motivo = motivo
+		close(c.fechada)
+
+		// Espera quem está em Write desistir ou terminar de enfileirar
+		c.escrevendo.Lock()
+		c.escrevendo.Unlock()
+
+		if esvaziar {
+			close(c.esvaziar)
+		} else {
+			close(c.derrubada)
+			c.Conn.Close()
+		}
+	})
+	return encerrou
+}
+
+// fechadaCom retorna o erro de uma conexão fechada, ou nil se ela está aberta
+func (c *conexaoComFalhas) fechadaCom() error {
+	select {
+	case <-c.fechada:
+		return c.motivo
+	default:
+		return nil
+	}
+}
+
+// escreverNoHorario espera o horário de entrega do pacote e o escreve na
+// conexão real. Retorna false se a conexão caiu.
+func (c *conexaoComFalhas) escreverNoHorario(p pacoteAtrasado, esvaziando bool) bool {
+	temporizador := time.NewTimer(time.Until(p.entrega))
+	defer temporizador.Stop()
+	select {
+	case <-temporizador.C:
+	case <-c.derrubada:
+		return false
+	}
+
+	if esvaziando {
+		c.Conn.SetWriteDeadline(p.entrega.Add(prazoEsvaziar))
+	}
+	if _, err := c.Conn.Write(p.dados); err != nil {
+		c.encerrar(err, false)
+		return false
+	}
+	return true
+}
+
+// enviar escreve na conexão os dados de Write, cada um no seu horário. Depois
+// de Close, entrega os pacotes que restam na fila e fecha a conexão real.
+func (c *conexaoComFalhas) enviar() {
+	defer c.Conn.Close()
+	for {
+		select {
+		case p := <-c.escrita:
+			if !c.escreverNoHorario(p, false) {
+				return
+			}
+		case <-c.esvaziar:
+			for {
+				select {
+				case p := <-c.escrita:
+					if !c.escreverNoHorario(p, true) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case <-c.derrubada:
+			return
+		}
+	}
+}
+
+// receber lê a conexão e guarda os dados para serem entregues a Read no seu
+// horário
+func (c *conexaoComFalhas) receber() {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := c.Conn.Read(buf)
+		entrega, derrubar := c.recepcao.agendar(n)
+		if derrubar {
+			c.encerrar(errConexaoDerrubada, false)
+			return
+		}
+		p := pacoteAtrasado{dados: append([]byte(nil), buf[:n]...), erro: err, entrega: entrega}
+		select {
+		case c.leitura <- p:
+		case <-c.fechada:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// proximoPacote espera o próximo pacote recebido e o seu horário de entrega,
+// respeitando o prazo de leitura. Um pacote cujo horário passa do prazo fica
+// guardado para a próxima chamada.
+func (c *conexaoComFalhas) proximoPacote() error {
+	for {
+		prazo, mudou := c.prazos.atual(false)
+		if vencido(prazo) {
+			return os.ErrDeadlineExceeded
+		}
+		venceu, parar := vencimento(prazo)
+
+		if c.proximo == nil {
+			select {
+			case p := <-c.leitura:
+				c.proximo = &p
+			case <-c.fechada:
+				parar()
+				return c.motivo
+			case <-venceu:
+			case <-mudou:
+			}
+			parar()
+			continue
+		}
+
+		temporizador := time.NewTimer(time.Until(c.proximo.entrega))
+		select {
+		case <-temporizador.C:
+			parar()
+			c.restante, c.erro = c.proximo.dados, c.proximo.erro
+			c.proximo = nil
+			return nil
+		case <-c.fechada:
+			temporizador.Stop()
+			parar()
+			return c.motivo
+		case <-venceu:
+		case <-mudou:
+		}
+		temporizador.Stop()
+		parar()
+	}
+}
+
+func (c *conexaoComFalhas) Read(b []byte) (int, error) {
+	if err := c.fechadaCom(); err != nil {
+		return 0, err
+	}
+	if len(c.restante) == 0 {
+		if c.erro != nil {
+			return 0, c.erro
+		}
+		if err := c.proximoPacote(); err != nil {
+			return 0, err
+		}
+		if len(c.restante) == 0 {
+			return 0, c.erro
+		}
+	}
+	n := copy(b, c.restante)
+	c.restante = c.restante[n:]
+	return n, nil
+}
+
+// Write coloca os dados na fila de envio e retorna sem esperar a entrega.
+// Só espera, respeitando o prazo de escrita, se a fila estiver cheia.
+func (c *conexaoComFalhas) Write(b []byte) (int, error) {
+	if err := c.fechadaCom(); err != nil {
+		return 0, err
+	}
+	if prazo, _ := c.prazos.atual(true); vencido(prazo) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	entrega, derrubar := c.envio.agendar(len(b))
+	if derrubar {
+		c.encerrar(errConexaoDerrubada, false)
+		return 0, errConexaoDerrubada
+	}
+	p := pacoteAtrasado{dados: append([]byte(nil), b...), entrega: entrega}
+
+	// Com escrevendo travado, encerrar não avança até o pacote entrar na
+	// fila ou Write desistir; fechada é conferido de novo sob a trava
+	c.escrevendo.RLock()
+	defer c.escrevendo.RUnlock()
+	if err := c.fechadaCom(); err != nil {
+		return 0, err
+	}
+	for {
+		prazo, mudou := c.prazos.atual(true)
+		if vencido(prazo) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		venceu, parar := vencimento(prazo)
+		select {
+		case c.escrita <- p:
+			parar()
+			return len(b), nil
+		case <-c.fechada:
+			parar()
+			return 0, c.motivo
+		case <-venceu:
+		case <-mudou:
+		}
+		parar()
+	}
+}
+
+// Close fecha a conexão para Read e Write; os dados já aceitos por Write
+// continuam sendo entregues nos seus horários antes de a conexão real fechar
+func (c *conexaoComFalhas) Close() error {
+	if !c.encerrar(net.ErrClosed, true) {
+		return net.ErrClosed
+	}
+	return nil
+}
+
+func (c *conexaoComFalhas) SetDeadline(t time.Time) error {
+	c.prazos.definir(&t, &t)
+	return nil
+}
+
+func (c *conexaoComFalhas) SetReadDeadline(t time.Time) error {
+	c.prazos.definir(&t, nil)
+	return nil
+}
+
+func (c *conexaoComFalhas) SetWriteDeadline(t time.Time) error {
+	c.prazos.definir(nil, &t)
+	return nil
+}
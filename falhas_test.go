@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// conexaoTeste retorna uma ponta de net.Pipe com as falhas dadas e a outra
+// ponta, sem falhas
+func conexaoTeste(t *testing.T, falhas ConfigFalhas) (*conexaoComFalhas, net.Conn) {
+	t.Helper()
+	a, b := net.Pipe()
+	c := novaConexaoComFalhas(a, falhas)
+	t.Cleanup(func() {
+		c.Close()
+		b.Close()
+	})
+	return c, b
+}
+
+func TestFalhasCloseEntregaEscritasPendentes(t *testing.T) {
+	c, outro := conexaoTeste(t, ConfigFalhas{Latencia: 50 * time.Millisecond})
+	if _, err := c.Write([]byte("ola, ")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write([]byte("mundo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Write([]byte("!")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Write depois de Close = %v, esperado net.ErrClosed", err)
+	}
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Read depois de Close = %v, esperado net.ErrClosed", err)
+	}
+
+	// Os dados aceitos antes de Close chegam, e depois a conexão fecha
+	recebido, err := io.ReadAll(outro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(recebido) != "ola, mundo" {
+		t.Errorf("recebido %q, esperado %q", recebido, "ola, mundo")
+	}
+}
+
+func TestFalhasQuedaDescartaEscritas(t *testing.T) {
+	c, _ := conexaoTeste(t, ConfigFalhas{Desconexao: 1, Semente: 1})
+	if _, err := c.Write([]byte("x")); !errors.Is(err, errConexaoDerrubada) {
+		t.Fatalf("Write = %v, esperado errConexaoDerrubada", err)
+	}
+	if _, err := c.Write([]byte("x")); !errors.Is(err, errConexaoDerrubada) {
+		t.Errorf("Write depois da queda = %v, esperado errConexaoDerrubada", err)
+	}
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, errConexaoDerrubada) {
+		t.Errorf("Read depois da queda = %v, esperado errConexaoDerrubada", err)
+	}
+}
+
+func TestFalhasPrazoDeLeitura(t *testing.T) {
+	c, outro := conexaoTeste(t, ConfigFalhas{Latencia: 100 * time.Millisecond})
+	go outro.Write([]byte("x"))
+
+	// O pacote chega depois do prazo: Read desiste e o guarda
+	c.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	buf := make([]byte, 1)
+	if _, err := c.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read = %v, esperado os.ErrDeadlineExceeded", err)
+	}
+
+	c.SetReadDeadline(time.Time{})
+	if n, err := c.Read(buf); err != nil || string(buf[:n]) != "x" {
+		t.Errorf("Read sem prazo = %q, %v", buf[:n], err)
+	}
+}
+
+func TestFalhasPrazoDeEscrita(t *testing.T) {
+	c, outro := conexaoTeste(t, ConfigFalhas{Latencia: 50 * time.Millisecond})
+	c.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := c.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+
+	// O prazo vence antes da entrega: novas escritas falham, mas o que já
+	// foi aceito continua sendo entregue
+	time.Sleep(20 * time.Millisecond)
+	if _, err := c.Write([]byte("d")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write depois do prazo = %v, esperado os.ErrDeadlineExceeded", err)
+	}
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(outro, buf); err != nil || string(buf) != "abc" {
+		t.Fatalf("recebido %q, %v", buf, err)
+	}
+
+	c.SetWriteDeadline(time.Time{})
+	if _, err := c.Write([]byte("e")); err != nil {
+		t.Errorf("Write sem prazo = %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+// hospedar.go - Modo hospedar: servidor e cliente no mesmo processo
+// Com -hospedar o processo inicia o servidor em segundo plano, na porta
+// configurada, e o próprio jogador entra nele por uma conexão em memória.
+// O log do servidor vai para um arquivo para não corromper a tela do jogo.
+// Quando o anfitrião sai, o servidor é encerrado de forma graciosa e os
+// demais jogadores recebem o aviso de encerramento.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// Hospedagem é um servidor executado em segundo plano pelo anfitrião
+type Hospedagem struct {
+	Servidor *ServidorJogo
+	Opcoes   OpcoesServidor
+
+	arquivoLog *os.File
+	parar      chan struct{} // fechado para iniciar o encerramento
+	fim        chan error    // recebe o resultado de servir
+}
+
+// Hospedar inicia o servidor em segundo plano e retorna quando ele já está
+// aceitando conexões. Mensagens de log passam a ser gravadas em arquivoLog.
+func Hospedar(opcoes OpcoesServidor, arquivoLog string) (*Hospedagem, error) {
+	arq, err := os.OpenFile(arquivoLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir o log do servidor: %v", err)
+	}
+
+	servidor, err := prepararServidor(opcoes)
+	if err != nil {
+		arq.Close()
+		return nil, fmt.Errorf("erro ao criar servidor: %v", err)
+	}
+
+	h := &Hospedagem{
+		Servidor:   servidor,
+		Opcoes:     opcoes,
+		arquivoLog: arq,
+		parar:      make(chan struct{}),
+		fim:        make(chan error, 1),
+	}
+
+	log.SetOutput(arq)
+	pronto := make(chan struct{})
+	go func() {
+		h.fim <- servidor.servir(opcoes, h.parar, func() { close(pronto) })
+	}()
+
+	// Aguardar as portas serem abertas (ou o erro ao abri-las)
+	select {
+	case <-pronto:
+		fmt.Println("Log do servidor em:", arquivoLog)
+		return h, nil
+	case err := <-h.fim:
+		h.fechar()
+		return nil, err
+	}
+}
+
+// Encerrar inicia o encerramento gracioso do servidor (aviso aos jogadores,
+// snapshot e fechamento das conexões) e aguarda sua conclusão
+func (h *Hospedagem) Encerrar() error {
+	close(h.parar)
+	err := <-h.fim
+	h.fechar()
+	return err
+}
+
+// fechar libera o registro de eventos e o arquivo de log
+func (h *Hospedagem) fechar() {
+	if h.Servidor.registro != nil {
+		h.Servidor.registro.Fechar()
+	}
+	log.SetOutput(os.Stderr)
+	h.arquivoLog.Close()
+}
@@ -0,0 +1,137 @@
+// interesse.go - Área de interesse de cada jogador
+// Com um mapa grande, enviar todos os jogadores em cada ObterEstado gasta
+// banda com quem está longe e entrega a um cliente modificado a posição de
+// todo mundo. O servidor envia a cada jogador só os jogadores dentro da sua
+// área de interesse, um quadrado de -raio-interesse células para cada lado em
+// volta dele, e informa na resposta quem entrou e quem saiu da área desde a
+// consulta anterior. O ID só vale com a chave da sessão do jogador (ver
+// sessoes.go), para que ninguém veja a área de outro jogador nem consuma os
+// seus avisos. Chamadas com o ID de quem não está no jogo, ou com a chave
+// errada, recebem o estado sem nenhum jogador; o total de jogadores no jogo
+// vai em todo estado. O espectador web e o registro de eventos continuam
+// vendo todos.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Raio padrão da área de interesse, em células
+const raioInteressePadrao = 30
+
+// Tempo durante o qual o cliente mostra quem apareceu ou sumiu da sua área
+const duracaoAvisoVizinhanca = 3 * time.Second
+
+// dentroDoRaio indica se (x, y) está a no máximo raio células de (cx, cy) em
+// cada eixo; com raio zero ou negativo, qualquer posição está dentro
+func dentroDoRaio(raio, cx, cy, x, y int) bool {
+	if raio <= 0 {
+		return true
+	}
+	dx, dy := x-cx, y-cy
+	return dx >= -raio && dx <= raio && dy >= -raio && dy <= raio
+}
+
+// estadoVisivel retorna a cópia do estado que o jogador pode ver e quem
+// entrou e quem saiu da sua área de interesse desde a cópia anterior. Só o
+// dono da sessão vê a área e avança os avisos; com outra chave a consulta
+// não muda nada. Deve ser chamada com o mutex do servidor travado, ao menos
+// para leitura; trava o mutex do jogador, que impede que ele se mova durante
+// a cópia, e só as regiões que cobrem a área de interesse.
+func (s *ServidorJogo) estadoVisivel(id int, sessao string) (estado EstadoJogo, apareceram, sumiram []int) {
+	j, existe := s.jogadores[id]
+	if !existe || !sessaoConfere(j, sessao) {
+		estado = s.estado
+		estado.Jogadores = map[int]JogadorInfo{}
+		estado.Mensagens = append([]string(nil), s.estado.Mensagens...)
+		estado.Versao = s.versaoAtual()
+		estado.TotalJogadores = len(s.jogadores)
+		return estado, nil, nil
+	}
+	if s.raioInteresse <= 0 {
+		return s.copiarEstado(), nil, nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	estado = s.copiarArea(j.info.PosX, j.info.PosY, s.raioInteresse)
+
+	visiveis := make(map[int]struct{}, len(estado.Jogadores))
+	for outro := range estado.Jogadores {
+		if outro == id {
+			continue
+		}
+		visiveis[outro] = struct{}{}
+		if _, conhecido := j.visiveis[outro]; !conhecido {
+			apareceram = append(apareceram, outro)
+		}
+	}
+	for outro := range j.visiveis {
+		if _, visivel := visiveis[outro]; !visivel {
+			sumiram = append(sumiram, outro)
+		}
+	}
+	j.visiveis = visiveis
+
+	sort.Ints(apareceram)
+	sort.Ints(sumiram)
+	return estado, apareceram, sumiram
+}
+
+// avisarVizinhanca guarda, para a interface, quem apareceu ou sumiu da área
+// de interesse do jogador; os nomes de quem sumiu vêm do estado anterior
+func (c *ClienteJogo) avisarVizinhanca(conexao *ClienteRPC, anterior, atual EstadoJogo, apareceram, sumiram []int) {
+	if len(apareceram) == 0 && len(sumiram) == 0 {
+		return
+	}
+
+	var partes []string
+	if nomes := nomesJogadores(atual, apareceram); nomes != "" {
+		partes = append(partes, nomes+" por perto")
+	}
+	if nomes := nomesJogadores(anterior, sumiram); nomes != "" {
+		partes = append(partes, nomes+" fora de vista")
+	}
+	if len(partes) == 0 {
+		return
+	}
+
+	conexao.mutex.Lock()
+	conexao.vizinhanca = strings.Join(partes, "; ")
+	conexao.avisoVizinhanca = time.Now()
+	conexao.mutex.Unlock()
+}
+
+// nomesJogadores lista os nomes dos jogadores do estado com os IDs dados
+func nomesJogadores(estado EstadoJogo, ids []int) string {
+	var nomes []string
+	for _, id := range ids {
+		if jogador, existe := estado.Jogadores[id]; existe {
+			nomes = append(nomes, jogador.Nome)
+		} else {
+			nomes = append(nomes, fmt.Sprintf("jogador %d", id))
+		}
+	}
+	return strings.Join(nomes, ", ")
+}
+
+// AvisoVizinhanca retorna o último aviso de quem apareceu ou sumiu da área de
+// interesse do jogador, ou "" se não houver um recente
+func (c *ClienteJogo) AvisoVizinhanca() string {
+	conexao := c.conexao
+	if conexao == nil {
+		return ""
+	}
+
+	conexao.mutex.Lock()
+	defer conexao.mutex.Unlock()
+
+	if time.Since(conexao.avisoVizinhanca) > duracaoAvisoVizinhanca {
+		return ""
+	}
+	return conexao.vizinhanca
+}
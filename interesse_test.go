@@ -0,0 +1,163 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// servidorInteresse cria um servidor com um mapa sem paredes internas e área
+// de interesse de raio células
+func servidorInteresse(raio int) *ServidorJogo {
+	s := novoServidorComMapa("", gerarMapaTeste(20, 10, 0, rand.New(rand.NewSource(1))))
+	s.raioInteresse = raio
+	return s
+}
+
+// entrarComSessao coloca um jogador no jogo e retorna o seu ID e a chave
+// da sua sessão
+func entrarComSessao(t *testing.T, s *ServidorJogo, nome string, simbolo rune) (int, string) {
+	t.Helper()
+	reply := EntrarReply{}
+	if err := s.Entrar(&EntrarArgs{Nome: nome, Simbolo: simbolo}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if !reply.Sucesso {
+		t.Fatalf("Entrar(%q): %s", nome, reply.Mensagem)
+	}
+	return reply.JogadorID, reply.Sessao
+}
+
+// obterEstadoTeste consulta o estado com o ID e a chave de sessão dados
+func obterEstadoTeste(t *testing.T, s *ServidorJogo, id int, sessao string) ObterEstadoReply {
+	t.Helper()
+	reply := ObterEstadoReply{}
+	if err := s.ObterEstado(&ObterEstadoArgs{JogadorID: id, Sessao: sessao}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+// idsVisiveis retorna os IDs dos jogadores do estado, em ordem
+func idsVisiveis(estado EstadoJogo) []int {
+	var ids []int
+	for id := range estado.Jogadores {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func TestInteresseAvisaQuemEntraESaiDaArea(t *testing.T) {
+	s := servidorInteresse(3)
+	ana, sessaoAna := entrarComSessao(t, s, "ana", 'A') // em (1, 1)
+	bia, _ := entrarComSessao(t, s, "bia", 'B')         // em (2, 1)
+
+	reply := obterEstadoTeste(t, s, ana, sessaoAna)
+	if ids := idsVisiveis(reply.Estado); !reflect.DeepEqual(ids, []int{ana, bia}) {
+		t.Fatalf("ana vê %v, esperado %v", ids, []int{ana, bia})
+	}
+	if !reflect.DeepEqual(reply.Apareceram, []int{bia}) || reply.Sumiram != nil {
+		t.Fatalf("apareceram %v, sumiram %v", reply.Apareceram, reply.Sumiram)
+	}
+
+	// Bia vai para (5, 1), a 4 células de ana
+	for i := 0; i < 3; i++ {
+		comandoTeste(t, s, EnviarComandoArgs{JogadorID: bia, Comando: NovoComandoMover(DirecaoDireita)})
+	}
+	reply = obterEstadoTeste(t, s, ana, sessaoAna)
+	if ids := idsVisiveis(reply.Estado); !reflect.DeepEqual(ids, []int{ana}) {
+		t.Fatalf("ana vê %v com bia fora da área", ids)
+	}
+	if reply.Apareceram != nil || !reflect.DeepEqual(reply.Sumiram, []int{bia}) {
+		t.Fatalf("apareceram %v, sumiram %v", reply.Apareceram, reply.Sumiram)
+	}
+	if reply.Estado.TotalJogadores != 2 {
+		t.Fatalf("total de jogadores %d, esperado 2", reply.Estado.TotalJogadores)
+	}
+
+	// De volta à borda da área
+	comandoTeste(t, s, EnviarComandoArgs{JogadorID: bia, Comando: NovoComandoMover(DirecaoEsquerda)})
+	reply = obterEstadoTeste(t, s, ana, sessaoAna)
+	if !reflect.DeepEqual(reply.Apareceram, []int{bia}) || reply.Sumiram != nil {
+		t.Fatalf("apareceram %v, sumiram %v", reply.Apareceram, reply.Sumiram)
+	}
+}
+
+func TestInteresseExigeSessao(t *testing.T) {
+	s := servidorInteresse(3)
+	ana, sessaoAna := entrarComSessao(t, s, "ana", 'A')
+	bia, sessaoBia := entrarComSessao(t, s, "bia", 'B')
+	if sessaoAna == "" || sessaoAna == sessaoBia {
+		t.Fatalf("chaves de sessão %q e %q", sessaoAna, sessaoBia)
+	}
+
+	// Bia consulta com o ID de ana: não vê ninguém e não muda os avisos de ana
+	for _, sessao := range []string{sessaoBia, "", "errada"} {
+		reply := obterEstadoTeste(t, s, ana, sessao)
+		if len(reply.Estado.Jogadores) != 0 || reply.Apareceram != nil || reply.Sumiram != nil {
+			t.Fatalf("com a chave %q: jogadores %v, apareceram %v, sumiram %v",
+				sessao, reply.Estado.Jogadores, reply.Apareceram, reply.Sumiram)
+		}
+		if reply.Estado.TotalJogadores != 2 {
+			t.Fatalf("com a chave %q: total de jogadores %d, esperado 2", sessao, reply.Estado.TotalJogadores)
+		}
+	}
+
+	reply := obterEstadoTeste(t, s, ana, sessaoAna)
+	if !reflect.DeepEqual(reply.Apareceram, []int{bia}) {
+		t.Fatalf("ana perdeu o aviso de bia: apareceram %v", reply.Apareceram)
+	}
+}
+
+func TestInteracaoNaoMostraPosicao(t *testing.T) {
+	s := servidorInteresse(3)
+	ana, _ := entrarComSessao(t, s, "ana", 'A')
+
+	comando := NovoComandoInteragir()
+	comando.Alvo = &Posicao{X: 2, Y: 1}
+	comandoTeste(t, s, EnviarComandoArgs{JogadorID: ana, Comando: comando})
+
+	ultima := s.estado.Mensagens[len(s.estado.Mensagens)-1]
+	if !strings.HasPrefix(ultima, "ana ") || strings.ContainsAny(ultima, "0123456789") {
+		t.Fatalf("mensagem da interação %q", ultima)
+	}
+}
+
+func TestComandosExigemSessao(t *testing.T) {
+	s := servidorInteresse(3)
+	ana, _ := entrarComSessao(t, s, "ana", 'A')
+	_, sessaoBia := entrarComSessao(t, s, "bia", 'B')
+	antes := s.instantaneo()
+
+	// Bia usa o ID de ana: nada acontece e a posição de ana não aparece
+	for _, sessao := range []string{sessaoBia, "", "errada"} {
+		for _, comando := range []Comando{NovoComandoMover(DirecaoBaixo), NovoComandoInteragir()} {
+			reply := EnviarComandoReply{}
+			if err := s.EnviarComando(&EnviarComandoArgs{JogadorID: ana, Sessao: sessao, Comando: comando}, &reply); err != nil {
+				t.Fatal(err)
+			}
+			if reply.Sucesso || reply.Mensagem != "Jogador não encontrado" || reply.PosX != 0 || reply.PosY != 0 {
+				t.Fatalf("%s com a chave %q: %+v", comando.Tipo, sessao, reply)
+			}
+		}
+
+		ping := PingReply{}
+		if err := s.Ping(&PingArgs{JogadorID: ana, Sessao: sessao, RTT: 1}, &ping); err != nil {
+			t.Fatal(err)
+		}
+		sair := SairReply{}
+		if err := s.Sair(&SairArgs{JogadorID: ana, Sessao: sessao}, &sair); err != nil {
+			t.Fatal(err)
+		}
+		if ping.Sucesso || sair.Sucesso {
+			t.Fatalf("com a chave %q: ping %+v, sair %+v", sessao, ping, sair)
+		}
+	}
+
+	if depois := s.instantaneo(); !reflect.DeepEqual(depois, antes) {
+		t.Fatalf("o estado mudou de %+v para %+v", antes, depois)
+	}
+}
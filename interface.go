@@ -1,81 +1,64 @@
-// interface.go - Interface gráfica do jogo usando termbox
-// O código abaixo implementa a interface gráfica do jogo usando a biblioteca termbox-go.
-// A biblioteca termbox-go é uma biblioteca de interface de terminal que permite desenhar
-// elementos na tela, capturar eventos do teclado e gerenciar a aparência do terminal.
+// interface.go - Interface gráfica do jogo
+// O código abaixo implementa a interface gráfica do jogo sobre um Renderizador
+// (veja renderizador.go). O renderizador desenha elementos na tela, captura
+// eventos do teclado e gerencia a aparência do terminal; por padrão é usado o
+// renderizador termbox.
 
 package main
 
 import (
 	"fmt"
-	"github.com/nsf/termbox-go"
 )
 
-// Define um tipo Cor para encapsuladar as cores do termbox
-type Cor = termbox.Attribute
-
-// Definições de cores utilizadas no jogo
-const (
-	CorPadrao     Cor = termbox.ColorDefault
-	CorCinzaEscuro    = termbox.ColorDarkGray
-	CorVermelho       = termbox.ColorRed
-	CorVerde          = termbox.ColorGreen
-	CorParede         = termbox.ColorBlack | termbox.AttrBold | termbox.AttrDim
-	CorFundoParede    = termbox.ColorDarkGray
-	CorTexto          = termbox.ColorDarkGray
-)
+// Tela onde a interface desenha, definida por interfaceIniciar
+var tela Renderizador
+
+// Mapa de teclas usado para traduzir as teclas em ações (veja teclas.go)
+var teclas = NovoMapaTeclasPadrao()
 
 // EventoTeclado representa uma ação detectada do teclado (como mover, sair ou interagir)
 type EventoTeclado struct {
-	Tipo  string // "sair", "interagir", "mover"
-	Tecla rune   // Tecla pressionada, usada no caso de movimento
+	Tipo    string  // "sair", "interagir", "mover", "atualizar"
+	Direcao Direcao // Direção do movimento, usada no caso de movimento
 }
 
-// Inicializa a interface gráfica usando termbox
-func interfaceIniciar() {
-	if err := termbox.Init(); err != nil {
+// Inicializa a interface gráfica usando o renderizador informado
+func interfaceIniciar(r Renderizador) {
+	tela = r
+	if err := tela.Iniciar(); err != nil {
 		panic(err)
 	}
 }
 
-// Encerra o uso da interface termbox
+// Define o mapa de teclas usado pela interface
+func interfaceDefinirTeclas(m *MapaTeclas) {
+	teclas = m
+}
+
+// Encerra o uso da interface e restaura o terminal
 func interfaceFinalizar() {
-	termbox.Close()
+	tela.Finalizar()
 }
 
 // Lê um evento do teclado e o traduz para um EventoTeclado
 func interfaceLerEventoTeclado() EventoTeclado {
-	ev := termbox.PollEvent()
-	if ev.Type != termbox.EventKey {
+	ev := tela.LerEvento()
+	switch ev.Tipo {
+	case EntradaInterrupcao, EntradaRedimensionar:
+		// Leitura interrompida ou terminal redimensionado: redesenhar a tela
+		return EventoTeclado{Tipo: "atualizar"}
+	case EntradaTecla:
+	default:
 		return EventoTeclado{}
 	}
-	if ev.Key == termbox.KeyEsc {
-		return EventoTeclado{Tipo: "sair"}
-	}
-	if ev.Ch == 'e' {
-		return EventoTeclado{Tipo: "interagir"}
-	}
-	return EventoTeclado{Tipo: "mover", Tecla: ev.Ch}
+	// Teclas sem ação associada são ignoradas
+	acao := teclas.Acao(ev)
+	return EventoTeclado{Tipo: acao.Tipo, Direcao: acao.Direcao}
 }
 
-// Renderiza todo o estado atual do jogo na tela
-func interfaceDesenharJogo(jogo *Jogo) {
-	interfaceLimparTela()
-
-	// Desenha todos os elementos do mapa
-	for y, linha := range jogo.Mapa {
-		for x, elem := range linha {
-			interfaceDesenharElemento(x, y, elem)
-		}
-	}
-
-	// Desenha o personagem sobre o mapa
-	interfaceDesenharElemento(jogo.PosX, jogo.PosY, Personagem)
-
-	// Desenha a barra de status
-	interfaceDesenharBarraDeStatus(jogo)
-
-	// Força a atualização do terminal
-	interfaceAtualizarTela()
+// Interrompe uma leitura de teclado em andamento (pode ser chamada de outra goroutine)
+func interfaceInterromperLeitura() {
+	tela.Interromper()
 }
 
 // Renderiza o estado do jogo multiplayer
@@ -94,7 +77,7 @@ func interfaceDesenharJogoMultiplayer(jogo *Jogo) {
 
 	// Desenha o personagem local sobre o mapa
 	interfaceDesenharElemento(jogo.PosX, jogo.PosY, Elemento{
-		Simbolo:  '☺',
+		Simbolo:  jogo.Cliente.Simbolo,
 		Cor:      jogo.Cliente.Cor,
 		CorFundo: CorPadrao,
 		Tangivel: true,
@@ -110,8 +93,9 @@ func interfaceDesenharJogoMultiplayer(jogo *Jogo) {
 		})
 	}
 
-	// Desenha a barra de status
+	// Desenha a barra de status e, ao lado, o indicador de conexão
 	interfaceDesenharBarraDeStatus(jogo)
+	interfaceDesenharIndicadorConexao(jogo, len(jogo.Mapa)+4)
 	
 	// Desenha informações de jogadores conectados
 	interfaceDesenharInfoJogadores(jogo)
@@ -129,23 +113,26 @@ func interfaceDesenharInfoJogadores(jogo *Jogo) {
 	// Mensagem com nome do jogador local
 	msgLocal := fmt.Sprintf("Você: %s", jogo.Cliente.Nome)
 	for i, c := range msgLocal {
-		termbox.SetCell(i, len(jogo.Mapa)+5, c, jogo.Cliente.Cor, CorPadrao)
+		tela.DefinirCelula(i, len(jogo.Mapa)+5, c, jogo.Cliente.Cor, CorPadrao)
 	}
 	
 	// Listagem de outros jogadores
 	msgOutros := "Outros jogadores: "
 	offset := len(msgOutros)
 	for i, c := range msgOutros {
-		termbox.SetCell(i, len(jogo.Mapa)+6, c, CorTexto, CorPadrao)
+		tela.DefinirCelula(i, len(jogo.Mapa)+6, c, CorTexto, CorPadrao)
 	}
 	
-	// Nomes dos outros jogadores
+	// Nomes dos outros jogadores, com o RTT que informaram ao servidor
 	linha := len(jogo.Mapa) + 6
 	coluna := offset
 	for _, jogador := range jogo.OutrosJogadores {
 		info := fmt.Sprintf("%s ", jogador.Nome)
+		if jogador.RTT > 0 {
+			info = fmt.Sprintf("%s (%d ms) ", jogador.Nome, jogador.RTT.Milliseconds())
+		}
 		for _, c := range info {
-			termbox.SetCell(coluna, linha, c, jogador.Cor, CorPadrao)
+			tela.DefinirCelula(coluna, linha, c, jogador.Cor, CorPadrao)
 			coluna++
 		}
 		
@@ -159,30 +146,186 @@ func interfaceDesenharInfoJogadores(jogo *Jogo) {
 
 // Limpa a tela do terminal
 func interfaceLimparTela() {
-	termbox.Clear(CorPadrao, CorPadrao)
+	tela.Limpar()
 }
 
 // Força a atualização da tela do terminal com os dados desenhados
 func interfaceAtualizarTela() {
-	termbox.Flush()
+	tela.Atualizar()
 }
 
 // Desenha um elemento na posição (x, y)
 func interfaceDesenharElemento(x, y int, elem Elemento) {
-	termbox.SetCell(x, y, elem.Simbolo, elem.Cor, elem.CorFundo)
+	tela.DefinirCelula(x, y, elem.Simbolo, elem.Cor, elem.CorFundo)
 }
 
 // Exibe uma barra de status com informações úteis ao jogador
 func interfaceDesenharBarraDeStatus(jogo *Jogo) {
 	// Linha de status dinâmica
 	for i, c := range jogo.StatusMsg {
-		termbox.SetCell(i, len(jogo.Mapa)+1, c, CorTexto, CorPadrao)
+		tela.DefinirCelula(i, len(jogo.Mapa)+1, c, CorTexto, CorPadrao)
 	}
 
-	// Instruções fixas
-	msg := "Use WASD para mover e E para interagir. ESC para sair."
+	// Aviso do último comando, como um movimento bloqueado
+	interfaceEscreverTexto(0, len(jogo.Mapa)+2, jogo.Aviso, CorAmarelo)
+
+	// Instruções, conforme o mapa de teclas em uso
+	msg := teclas.Dica()
 	for i, c := range msg {
-		termbox.SetCell(i, len(jogo.Mapa)+3, c, CorTexto, CorPadrao)
+		tela.DefinirCelula(i, len(jogo.Mapa)+3, c, CorTexto, CorPadrao)
+	}
+}
+
+// Mostra a qualidade da conexão: o RTT médio e a variação em verde, amarelo
+// ou vermelho e, se alguma chamada espera o servidor há um tempo perceptível,
+// há quanto tempo (em vermelho depois da metade do tempo limite)
+func interfaceDesenharIndicadorConexao(jogo *Jogo, linha int) {
+	if jogo.Cliente == nil {
+		return
+	}
+	latencia := jogo.Cliente.Latencia()
+	quantas, espera := jogo.Cliente.ChamadasPendentes()
+
+	texto := "● conexão: medindo..."
+	cor := CorTexto
+	if latencia.Medidas > 0 {
+		texto = fmt.Sprintf("● conexão: %d ms (±%d ms)", latencia.Media.Milliseconds(), latencia.Variacao.Milliseconds())
+		switch {
+		case latencia.Media >= latenciaRuim:
+			cor = CorVermelho
+		case latencia.Media >= latenciaBoa:
+			cor = CorAmarelo
+		default:
+			cor = CorVerde
+		}
+	}
+	if espera >= esperaVisivel {
+		texto += fmt.Sprintf(" - aguardando o servidor há %.1f s (%d chamadas)", espera.Seconds(), quantas)
+		if cor != CorVermelho {
+			cor = CorAmarelo
+		}
+		if tempoLimiteChamada > 0 && espera > tempoLimiteChamada/2 {
+			cor = CorVermelho
+		}
+	}
+	interfaceEscreverTexto(0, linha, texto, cor)
+}
+
+
+// Escreve um texto na tela a partir da posição (x, y)
+func interfaceEscreverTexto(x, y int, texto string, cor Cor) {
+	for _, c := range texto {
+		tela.DefinirCelula(x, y, c, cor, CorPadrao)
+		x++
 	}
 }
 
+// Exibe o menu de escolha do símbolo e da cor do personagem antes do jogo.
+// aviso e sugestoes vêm da recusa anterior do servidor, se houver.
+// Retorna false se o jogador desistir com ESC.
+func interfaceEscolherAparencia(nome string, inicial Aparencia, aviso string, sugestoes []Aparencia) (Aparencia, bool) {
+	// Símbolos oferecidos, incluindo o atual se não estiver na lista
+	simbolos := append([]rune{}, simbolosSugeridos...)
+	iSimbolo := -1
+	for i, s := range simbolos {
+		if s == inicial.Simbolo {
+			iSimbolo = i
+		}
+	}
+	if iSimbolo < 0 {
+		simbolos = append(simbolos, inicial.Simbolo)
+		iSimbolo = len(simbolos) - 1
+	}
+	iCor := 0
+	for i, c := range nomesCores {
+		if c.Cor == inicial.Cor {
+			iCor = i
+		}
+	}
+	digitando := false // próxima tecla é um símbolo digitado pelo jogador
+
+	for {
+		atual := Aparencia{simbolos[iSimbolo], nomesCores[iCor].Cor}
+
+		tela.Limpar()
+		interfaceEscreverTexto(0, 0, "Escolha seu personagem", CorPadrao)
+
+		interfaceEscreverTexto(0, 2, "Símbolo:", CorTexto)
+		for i, s := range simbolos {
+			cor := atual.Cor
+			if i == iSimbolo {
+				cor |= AtributoInverso
+			}
+			tela.DefinirCelula(10+2*i, 2, s, cor, CorPadrao)
+		}
+		interfaceEscreverTexto(0, 3, "Cor:", CorTexto)
+		interfaceEscreverTexto(10, 3, "◄ "+nomesCores[iCor].Nome+" ►", atual.Cor)
+
+		interfaceEscreverTexto(0, 5, "Prévia:", CorTexto)
+		tela.DefinirCelula(10, 5, atual.Simbolo, atual.Cor, CorPadrao)
+		interfaceEscreverTexto(12, 5, nome, atual.Cor)
+
+		linha := 7
+		if aviso != "" {
+			interfaceEscreverTexto(0, linha, aviso, CorVermelho)
+			linha++
+		}
+		if len(sugestoes) > 0 {
+			interfaceEscreverTexto(0, linha, "Sugestões:", CorTexto)
+			x := 12
+			for i, sug := range sugestoes {
+				interfaceEscreverTexto(x, linha, fmt.Sprintf("%d ", i+1), CorTexto)
+				tela.DefinirCelula(x+2, linha, sug.Simbolo, sug.Cor, CorPadrao)
+				x += 5
+			}
+			linha++
+		}
+
+		linha++
+		if digitando {
+			interfaceEscreverTexto(0, linha, "Digite o caractere que deseja usar como símbolo", CorPadrao)
+		} else {
+			interfaceEscreverTexto(0, linha, "A/D ou ←/→: símbolo   W/S ou ↑/↓: cor   TAB: digitar outro símbolo", CorTexto)
+			if len(sugestoes) > 0 {
+				interfaceEscreverTexto(0, linha+1, fmt.Sprintf("1-%d: usar uma sugestão   ENTER: jogar   ESC: sair", len(sugestoes)), CorTexto)
+			} else {
+				interfaceEscreverTexto(0, linha+1, "ENTER: jogar   ESC: sair", CorTexto)
+			}
+		}
+		interfaceAtualizarTela()
+
+		ev := tela.LerEvento()
+		if ev.Tipo != EntradaTecla {
+			continue
+		}
+
+		if digitando {
+			digitando = false
+			if ev.Tecla == TeclaNenhuma {
+				// O servidor valida o símbolo ao entrar
+				simbolos = append(simbolos, ev.Ch)
+				iSimbolo = len(simbolos) - 1
+			}
+			continue
+		}
+
+		switch {
+		case ev.Tecla == TeclaEsc:
+			return inicial, false
+		case ev.Tecla == TeclaEnter:
+			return atual, true
+		case ev.Tecla == TeclaTab:
+			digitando = true
+		case ev.Tecla == TeclaSetaEsquerda || ev.Ch == 'a':
+			iSimbolo = (iSimbolo + len(simbolos) - 1) % len(simbolos)
+		case ev.Tecla == TeclaSetaDireita || ev.Ch == 'd':
+			iSimbolo = (iSimbolo + 1) % len(simbolos)
+		case ev.Tecla == TeclaSetaCima || ev.Ch == 'w':
+			iCor = (iCor + len(nomesCores) - 1) % len(nomesCores)
+		case ev.Tecla == TeclaSetaBaixo || ev.Ch == 's':
+			iCor = (iCor + 1) % len(nomesCores)
+		case ev.Ch >= '1' && int(ev.Ch-'0') <= len(sugestoes):
+			return sugestoes[ev.Ch-'1'], true
+		}
+	}
+}
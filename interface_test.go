@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// jogoTeste conecta um cliente em memória a um servidor novo e prepara a
+// interface sobre um renderizador em memória
+func jogoTeste(t *testing.T) (*Jogo, *RenderizadorMemoria) {
+	t.Helper()
+	servidor, err := NovoServidor("mapa.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cliente, err := NovoClienteLocal(servidor, EntrarArgs{Nome: "Teste", Simbolo: '@'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cliente.Sair() })
+
+	tela := NovoRenderizadorMemoria(250, 40)
+	interfaceIniciar(tela)
+	t.Cleanup(interfaceFinalizar)
+
+	jogo := jogoNovoMultiplayer(cliente)
+	return &jogo, tela
+}
+
+// esperarQuadro redesenha o jogo até que pronto aceite a tela
+func esperarQuadro(t *testing.T, jogo *Jogo, tela *RenderizadorMemoria, pronto func() bool) {
+	t.Helper()
+	for limite := time.Now().Add(2 * time.Second); time.Now().Before(limite); time.Sleep(5 * time.Millisecond) {
+		interfaceDesenharJogoMultiplayer(jogo)
+		if pronto() {
+			return
+		}
+	}
+	t.Fatalf("a tela não chegou ao estado esperado:\n%s", tela.UltimoQuadro())
+}
+
+// teclar envia o evento à tela e o executa como o loop principal, pulando as
+// interrupções deixadas pelas respostas anteriores; retorna se o jogo continua
+func teclar(jogo *Jogo, tela *RenderizadorMemoria, ev EventoEntrada) bool {
+	tela.Enviar(ev)
+	for {
+		evento := interfaceLerEventoTeclado()
+		if evento.Tipo == "atualizar" {
+			interfaceDesenharJogoMultiplayer(jogo)
+			continue
+		}
+		return personagemExecutarAcaoMultiplayer(evento, jogo)
+	}
+}
+
+func TestInterfaceMoverComTeclado(t *testing.T) {
+	jogo, tela := jogoTeste(t)
+	interfaceDesenharJogoMultiplayer(jogo)
+	if c := tela.Celula(1, 1); c.Ch != '@' {
+		t.Fatalf("personagem ausente em (1, 1), encontrado %q", c.Ch)
+	}
+
+	if !teclar(jogo, tela, EventoEntrada{Tipo: EntradaTecla, Ch: 'd'}) {
+		t.Fatal("a tecla d encerrou o jogo")
+	}
+	esperarQuadro(t, jogo, tela, func() bool { return tela.Celula(2, 1).Ch == '@' })
+	if c := tela.Celula(1, 1); c.Ch == '@' {
+		t.Fatal("personagem ainda desenhado na posição anterior")
+	}
+
+	// Um movimento contra a parede é avisado na barra de status
+	teclar(jogo, tela, EventoEntrada{Tipo: EntradaTecla, Ch: 'w'})
+	esperarQuadro(t, jogo, tela, func() bool { return strings.Contains(tela.UltimoQuadro(), "Bloqueado por parede") })
+
+	if teclar(jogo, tela, EventoEntrada{Tipo: EntradaTecla, Tecla: TeclaEsc}) {
+		t.Fatal("ESC não encerrou o jogo")
+	}
+}
+
+func TestRenderizadorMemoriaInterromperNaoBloqueia(t *testing.T) {
+	tela := NovoRenderizadorMemoria(10, 10)
+	feito := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			tela.Interromper()
+		}
+		close(feito)
+	}()
+	select {
+	case <-feito:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Interromper bloqueou com a fila de eventos cheia")
+	}
+	if ev := tela.LerEvento(); ev.Tipo != EntradaInterrupcao {
+		t.Fatalf("evento %+v, esperado uma interrupção", ev)
+	}
+}
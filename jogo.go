@@ -1,4 +1,4 @@
-// jogo.go - Funções para manipular os elementos do jogo, como carregar o mapa e mover o personagem
+// jogo.go - Funções para manipular os elementos do jogo, como carregar o mapa e aplicar o estado do servidor
 package main
 
 import (
@@ -18,18 +18,17 @@ type Elemento struct {
 type Jogo struct {
 	Mapa            [][]Elemento // grade 2D representando o mapa
 	PosX, PosY      int          // posição atual do personagem
-	UltimoVisitado  Elemento     // elemento que estava na posição do personagem antes de mover
 	StatusMsg       string       // mensagem para a barra de status
+	Aviso           string       // aviso do último comando (ex. movimento bloqueado)
 	Cliente         *ClienteJogo // referência ao cliente para modo multiplayer
 	OutrosJogadores map[int]JogadorInfo // informações sobre outros jogadores
+	Comandos        chan comandoPendente // comandos enviados em segundo plano (veja personagem.go)
+	Resultados      chan func(*Jogo)     // respostas dos comandos, aplicadas pelo loop principal
 }
 
 // Cria e retorna uma nova instância do jogo
 func jogoNovo() Jogo {
-	// O ultimo elemento visitado é inicializado como vazio
-	// pois o jogo começa com o personagem em uma posição vazia
 	return Jogo{
-		UltimoVisitado: Vazio,
 		OutrosJogadores: make(map[int]JogadorInfo),
 	}
 }
@@ -37,10 +36,15 @@ func jogoNovo() Jogo {
 // Cria uma nova instância do jogo para modo multiplayer
 func jogoNovoMultiplayer(cliente *ClienteJogo) Jogo {
 	jogo := Jogo{
-		UltimoVisitado: Vazio,
 		Cliente: cliente,
 		OutrosJogadores: make(map[int]JogadorInfo),
+		Comandos:        make(chan comandoPendente, maximoComandosPendentes),
+		Resultados:      make(chan func(*Jogo), maximoComandosPendentes),
 	}
+	
+	// Os comandos são enviados por outra goroutine para que a interface não
+	// trave esperando o servidor
+	go personagemEnviarComandos(cliente.enviador(), jogo.Comandos, jogo.Resultados)
 	return jogo
 }
 
@@ -80,56 +84,29 @@ func jogoCarregarMapa(nome string, jogo *Jogo) error {
 	return nil
 }
 
-// Verifica se o personagem pode se mover para a posição (x, y)
-func jogoPodeMoverPara(jogo *Jogo, x, y int) bool {
-	// Verifica se a coordenada Y está dentro dos limites verticais do mapa
-	if y < 0 || y >= len(jogo.Mapa) {
-		return false
-	}
-
-	// Verifica se a coordenada X está dentro dos limites horizontais do mapa
-	if x < 0 || x >= len(jogo.Mapa[y]) {
-		return false
-	}
-
-	// Verifica se o elemento de destino é tangível (bloqueia passagem)
-	if jogo.Mapa[y][x].Tangivel {
-		return false
-	}
-
-	// Em modo multiplayer, verificar se há outro jogador na posição
-	if jogo.OutrosJogadores != nil {
-		for _, outroJogador := range jogo.OutrosJogadores {
-			if outroJogador.PosX == x && outroJogador.PosY == y {
-				return false
-			}
+// Aplica as respostas dos comandos enviados em segundo plano
+func jogoAplicarResultados(jogo *Jogo) {
+	for {
+		select {
+		case aplicar := <-jogo.Resultados:
+			aplicar(jogo)
+		default:
+			return
 		}
 	}
-
-	// Pode mover para a posição
-	return true
-}
-
-// Move um elemento para a nova posição
-func jogoMoverElemento(jogo *Jogo, x, y, dx, dy int) {
-	nx, ny := x+dx, y+dy
-
-	// Obtem elemento atual na posição
-	elemento := jogo.Mapa[y][x] // guarda o conteúdo atual da posição
-
-	jogo.Mapa[y][x] = jogo.UltimoVisitado     // restaura o conteúdo anterior
-	jogo.UltimoVisitado = jogo.Mapa[ny][nx]   // guarda o conteúdo atual da nova posição
-	jogo.Mapa[ny][nx] = elemento              // move o elemento
 }
 
 // Atualiza o estado do jogo com base no estado recebido do servidor
 func jogoAtualizarEstadoMultiplayer(jogo *Jogo) {
-	if jogo.Cliente == nil || clienteRPC == nil {
+	if jogo.Cliente == nil {
 		return
 	}
 	
+	// Aplicar as respostas dos comandos que chegaram desde o último desenho
+	jogoAplicarResultados(jogo)
+	
 	// Obter o estado atual do servidor (já atualizado pela goroutine)
-	estado := clienteRPC.Estado
+	estado := jogo.Cliente.Estado()
 	
 	// Atualizar posição do jogador local
 	jogadorLocal, existe := estado.Jogadores[jogo.Cliente.ID]
@@ -140,6 +117,11 @@ func jogoAtualizarEstadoMultiplayer(jogo *Jogo) {
 	jogo.PosX = jogadorLocal.PosX
 	jogo.PosY = jogadorLocal.PosY
 	
+	// Com a predição ativa, mostrar a posição prevista
+	if x, y, ok := jogo.Cliente.PosicaoPrevista(); ok {
+		jogo.PosX, jogo.PosY = x, y
+	}
+	
 	// Atualizar mapa com base no estado do servidor
 	if len(estado.ElementosMapa) > 0 {
 		jogo.Mapa = estado.ElementosMapa
@@ -157,4 +139,10 @@ func jogoAtualizarEstadoMultiplayer(jogo *Jogo) {
 	if len(estado.Mensagens) > 0 {
 		jogo.StatusMsg = estado.Mensagens[len(estado.Mensagens)-1]
 	}
+	if aviso := jogo.Cliente.AvisoVizinhanca(); aviso != "" {
+		jogo.StatusMsg = aviso
+	}
+	if jogo.Cliente.ServidorEncerrado() {
+		jogo.StatusMsg = "servidor encerrado"
+	}
 }
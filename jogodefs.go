@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 // ClienteJogo encapsula as informações de um cliente conectado ao jogo
 type ClienteJogo struct {
 	ID      int
@@ -8,6 +10,10 @@ type ClienteJogo struct {
 	Cor     Cor
 	PosX    int
 	PosY    int
+	conexao *ClienteRPC // conexão com o servidor (nil após Sair)
+	sessao  string      // chave da sessão recebida em Entrar
+
+	predicao *Predicao // predição de movimento (nil se desativada)
 }
 
 // JogadorInfo contém informações sobre um jogador conectado
@@ -18,13 +24,25 @@ type JogadorInfo struct {
 	Simbolo rune
 	Cor     Cor
 	Nome    string
+
+	// Último comando numerado aceito do jogador, usado pelo cliente para
+	// reconciliar a predição de movimento (veja predicao.go)
+	UltimaSequencia uint64
+
+	// Tempo de ida e volta médio informado pelo cliente no último Ping
+	// (zero se ainda não informado; veja rtt.go)
+	RTT time.Duration
 }
 
 // EstadoJogo representa o estado global do jogo no servidor
 type EstadoJogo struct {
-	Jogadores     map[int]JogadorInfo
-	ElementosMapa [][]Elemento
-	Mensagens     []string
+	Jogadores            map[int]JogadorInfo
+	ElementosMapa        [][]Elemento
+	Mensagens            []string
+	Encerrando           bool   // o servidor está em processo de encerramento
+	SegundosParaEncerrar int    // contagem regressiva do encerramento
+	Versao               uint64 // incrementada a cada mudança de estado
+	TotalJogadores       int    // jogadores no jogo, inclusive os fora da área de interesse
 }
 
 // Elementos visuais do jogo (com campos exportados)
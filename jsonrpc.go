@@ -0,0 +1,343 @@
+// jsonrpc.go - Endpoint JSON-RPC para clientes escritos em outras linguagens
+// Os mesmos métodos do ServidorJogo são oferecidos via net/rpc/jsonrpc (JSON-RPC 1.0)
+// em uma porta separada. Como rune e Cor não têm representação natural fora de Go,
+// os métodos usam tipos próprios: símbolos são strings de um caractere e cores são
+// nomes ("vermelho", "cinza_escuro", ...). O formato está descrito em docs/jsonrpc.md.
+package main
+
+import (
+	"fmt"
+	"net/rpc"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// ServidorJSON adapta o ServidorJogo para clientes JSON-RPC
+type ServidorJSON struct {
+	jogo *ServidorJogo
+}
+
+// JogadorJSON é a representação de JogadorInfo em JSON
+type JogadorJSON struct {
+	ID      int    `json:"id"`
+	Nome    string `json:"nome"`
+	PosX    int    `json:"pos_x"`
+	PosY    int    `json:"pos_y"`
+	Simbolo string `json:"simbolo"`
+	Cor     string `json:"cor"`
+
+	UltimaSequencia uint64 `json:"ultima_sequencia"` // último comando numerado aceito
+	RTTMs           int64  `json:"rtt_ms"`           // último RTT informado pelo jogador (0 se nenhum)
+}
+
+// EstadoJSON é a representação de EstadoJogo em JSON; o mapa é enviado como
+// uma string por linha, com os mesmos símbolos do arquivo de mapa
+type EstadoJSON struct {
+	Jogadores            []JogadorJSON `json:"jogadores"`
+	Mapa                 []string      `json:"mapa"`
+	Mensagens            []string      `json:"mensagens"`
+	Encerrando           bool          `json:"encerrando"`
+	SegundosParaEncerrar int           `json:"segundos_para_encerrar"`
+	TotalJogadores       int           `json:"total_jogadores"` // inclusive os fora da área de interesse
+}
+
+// Args e respostas dos métodos JSON-RPC, equivalentes aos de rpc.go
+type EntrarArgsJSON struct {
+	Nome    string `json:"nome"`
+	Simbolo string `json:"simbolo"`
+	Cor     string `json:"cor"`
+	Senha   string `json:"senha"`
+}
+
+type EntrarReplyJSON struct {
+	JogadorID int             `json:"jogador_id"`
+	Nome      string          `json:"nome"`
+	Sessao    string          `json:"sessao"` // exigida nas chamadas seguintes
+	Sucesso   bool            `json:"sucesso"`
+	Mensagem  string          `json:"mensagem"`
+	Estado    EstadoJSON      `json:"estado"`
+	Sugestoes []AparenciaJSON `json:"sugestoes,omitempty"` // quando símbolo ou cor são recusados
+}
+
+// AparenciaJSON é uma combinação de símbolo e cor sugerida pelo servidor
+type AparenciaJSON struct {
+	Simbolo string `json:"simbolo"`
+	Cor     string `json:"cor"`
+}
+
+type RegistrarArgsJSON struct {
+	Nome  string `json:"nome"`
+	Senha string `json:"senha"`
+}
+
+type RegistrarReplyJSON struct {
+	Nome     string `json:"nome"`
+	Sucesso  bool   `json:"sucesso"`
+	Mensagem string `json:"mensagem"`
+}
+
+type EnviarComandoArgsJSON struct {
+	JogadorID int          `json:"jogador_id"`
+	Sessao    string       `json:"sessao"`    // recebida em Entrar
+	Tipo      string       `json:"tipo"`      // "mover", "interagir", "chat" ou "usar"
+	Direcao   string       `json:"direcao"`   // "cima", "baixo", "esquerda" ou "direita" para movimento
+	Tecla     string       `json:"tecla"`     // obsoleto: "w", "a", "s" ou "d", se direcao não for informada
+	Alvo      *PosicaoJSON `json:"alvo"`      // célula alvo de uma interação (opcional)
+	Item      int          `json:"item"`      // item a usar
+	Texto     string       `json:"texto"`     // mensagem de chat
+	Sequencia uint64       `json:"sequencia"` // número do comando, crescente (opcional, para predição)
+}
+
+// PosicaoJSON é uma célula do mapa
+type PosicaoJSON struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type EnviarComandoReplyJSON struct {
+	Sucesso      bool   `json:"sucesso"`
+	Mensagem     string `json:"mensagem"`
+	PosX         int    `json:"pos_x"`
+	PosY         int    `json:"pos_y"`
+	Bloqueado    bool   `json:"bloqueado"`
+	BloqueadoPor string `json:"bloqueado_por,omitempty"`
+	Versao       uint64 `json:"versao"`
+	Sequencia    uint64 `json:"sequencia"` // último comando numerado aceito do jogador
+}
+
+type ObterEstadoArgsJSON struct {
+	JogadorID int    `json:"jogador_id"`
+	Sessao    string `json:"sessao"` // recebida em Entrar
+}
+
+type ObterEstadoReplyJSON struct {
+	Estado     EstadoJSON `json:"estado"`
+	Sucesso    bool       `json:"sucesso"`
+	Mensagem   string     `json:"mensagem"`
+	Apareceram []int      `json:"apareceram,omitempty"` // IDs que entraram na área de interesse
+	Sumiram    []int      `json:"sumiram,omitempty"`    // IDs que saíram da área de interesse
+}
+
+type PingArgsJSON struct {
+	JogadorID int    `json:"jogador_id"`
+	Sessao    string `json:"sessao"` // recebida em Entrar
+	RTTMs     int64  `json:"rtt_ms"` // RTT medido pelo cliente, em ms (0 se ainda não medido)
+}
+
+type PingReplyJSON struct {
+	Sucesso  bool   `json:"sucesso"`
+	Mensagem string `json:"mensagem"`
+}
+
+type SairArgsJSON struct {
+	JogadorID int    `json:"jogador_id"`
+	Sessao    string `json:"sessao"` // recebida em Entrar
+}
+
+type SairReplyJSON struct {
+	Sucesso  bool   `json:"sucesso"`
+	Mensagem string `json:"mensagem"`
+}
+
+// novoServidorRPCJSON cria o servidor net/rpc que atende as conexões JSON-RPC.
+// O nome registrado é o mesmo do servidor gob, então os métodos se chamam
+// "ServidorJogo.Entrar", "ServidorJogo.ObterEstado" etc. nos dois protocolos.
+func novoServidorRPCJSON(s *ServidorJogo) (*rpc.Server, error) {
+	rpcServidor := rpc.NewServer()
+	if err := rpcServidor.RegisterName("ServidorJogo", &ServidorJSON{jogo: s}); err != nil {
+		return nil, err
+	}
+	return rpcServidor, nil
+}
+
+// Converte um texto com exatamente um caractere para rune
+func simboloDeTexto(texto string) (rune, error) {
+	if utf8.RuneCountInString(texto) != 1 {
+		return 0, fmt.Errorf("símbolo deve ter exatamente um caractere: %q", texto)
+	}
+	r, _ := utf8.DecodeRuneInString(texto)
+	return r, nil
+}
+
+// Converte um JogadorInfo para JSON
+func jogadorParaJSON(j JogadorInfo) JogadorJSON {
+	return JogadorJSON{
+		ID:      j.ID,
+		Nome:    j.Nome,
+		PosX:    j.PosX,
+		PosY:    j.PosY,
+		Simbolo: string(j.Simbolo),
+		Cor:     corNome(j.Cor),
+
+		UltimaSequencia: j.UltimaSequencia,
+		RTTMs:           j.RTT.Milliseconds(),
+	}
+}
+
+// Converte um EstadoJogo para JSON (jogadores ordenados por ID)
+func estadoParaJSON(estado EstadoJogo) EstadoJSON {
+	ids := make([]int, 0, len(estado.Jogadores))
+	for id := range estado.Jogadores {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	jogadores := make([]JogadorJSON, 0, len(ids))
+	for _, id := range ids {
+		jogadores = append(jogadores, jogadorParaJSON(estado.Jogadores[id]))
+	}
+
+	mapa := make([]string, len(estado.ElementosMapa))
+	for y, linha := range estado.ElementosMapa {
+		simbolos := make([]rune, len(linha))
+		for x, elem := range linha {
+			simbolos[x] = elem.Simbolo
+		}
+		mapa[y] = string(simbolos)
+	}
+
+	return EstadoJSON{
+		Jogadores:            jogadores,
+		Mapa:                 mapa,
+		Mensagens:            append([]string{}, estado.Mensagens...),
+		Encerrando:           estado.Encerrando,
+		SegundosParaEncerrar: estado.SegundosParaEncerrar,
+		TotalJogadores:       estado.TotalJogadores,
+	}
+}
+
+// Entrar permite que um cliente JSON-RPC entre no jogo
+func (s *ServidorJSON) Entrar(args *EntrarArgsJSON, reply *EntrarReplyJSON) error {
+	simbolo, err := simboloDeTexto(args.Simbolo)
+	if err != nil {
+		reply.Sucesso = false
+		reply.Mensagem = err.Error()
+		return nil
+	}
+	cor, ok := corPorNome(args.Cor)
+	if args.Cor != "" && !ok {
+		reply.Sucesso = false
+		reply.Mensagem = fmt.Sprintf("cor desconhecida: %q", args.Cor)
+		return nil
+	}
+
+	r := EntrarReply{}
+	entrar := EntrarArgs{Nome: args.Nome, Simbolo: simbolo, Cor: cor, Senha: args.Senha}
+	if err := s.jogo.Entrar(&entrar, &r); err != nil {
+		return err
+	}
+
+	reply.JogadorID = r.JogadorID
+	reply.Nome = r.Nome
+	reply.Sessao = r.Sessao
+	reply.Sucesso = r.Sucesso
+	reply.Mensagem = r.Mensagem
+	reply.Estado = estadoParaJSON(r.Estado)
+	for _, a := range r.Sugestoes {
+		reply.Sugestoes = append(reply.Sugestoes, AparenciaJSON{Simbolo: string(a.Simbolo), Cor: corNome(a.Cor)})
+	}
+	return nil
+}
+
+// Registrar cria uma conta de jogador para um cliente JSON-RPC
+func (s *ServidorJSON) Registrar(args *RegistrarArgsJSON, reply *RegistrarReplyJSON) error {
+	r := RegistrarReply{}
+	if err := s.jogo.Registrar(&RegistrarArgs{Nome: args.Nome, Senha: args.Senha}, &r); err != nil {
+		return err
+	}
+
+	reply.Nome = r.Nome
+	reply.Sucesso = r.Sucesso
+	reply.Mensagem = r.Mensagem
+	return nil
+}
+
+// EnviarComando processa um comando de um cliente JSON-RPC
+func (s *ServidorJSON) EnviarComando(args *EnviarComandoArgsJSON, reply *EnviarComandoReplyJSON) error {
+	comando, err := comandoDeJSON(args)
+	if err != nil {
+		reply.Sucesso = false
+		reply.Mensagem = err.Error()
+		return nil
+	}
+
+	r := EnviarComandoReply{}
+	if err := s.jogo.EnviarComando(&EnviarComandoArgs{JogadorID: args.JogadorID, Sessao: args.Sessao, Comando: comando, Sequencia: args.Sequencia}, &r); err != nil {
+		return err
+	}
+
+	reply.Sucesso = r.Sucesso
+	reply.Mensagem = r.Mensagem
+	reply.PosX, reply.PosY = r.PosX, r.PosY
+	reply.Bloqueado = r.Bloqueado
+	reply.BloqueadoPor = r.BloqueadoPor
+	reply.Versao = r.Versao
+	reply.Sequencia = r.Sequencia
+	return nil
+}
+
+// comandoDeJSON converte os argumentos JSON em um Comando. A validação do
+// comando em si fica com o servidor (validarComando).
+func comandoDeJSON(args *EnviarComandoArgsJSON) (Comando, error) {
+	tipo, ok := tipoComandoPorNome(args.Tipo)
+	if !ok {
+		return Comando{}, fmt.Errorf("comando desconhecido: %q", args.Tipo)
+	}
+	comando := Comando{Tipo: tipo, Item: args.Item, Texto: args.Texto}
+
+	if args.Direcao != "" {
+		if comando.Direcao, ok = direcaoPorNome(args.Direcao); !ok {
+			return Comando{}, fmt.Errorf("direção desconhecida: %q", args.Direcao)
+		}
+	} else if args.Tecla != "" {
+		tecla, err := simboloDeTexto(args.Tecla)
+		if err != nil {
+			return Comando{}, err
+		}
+		comando.Direcao = direcaoDeTecla(tecla)
+	}
+	if args.Alvo != nil {
+		comando.Alvo = &Posicao{X: args.Alvo.X, Y: args.Alvo.Y}
+	}
+	return comando, nil
+}
+
+// ObterEstado retorna o estado atual do jogo em JSON
+func (s *ServidorJSON) ObterEstado(args *ObterEstadoArgsJSON, reply *ObterEstadoReplyJSON) error {
+	r := ObterEstadoReply{}
+	if err := s.jogo.ObterEstado(&ObterEstadoArgs{JogadorID: args.JogadorID, Sessao: args.Sessao}, &r); err != nil {
+		return err
+	}
+
+	reply.Estado = estadoParaJSON(r.Estado)
+	reply.Sucesso = r.Sucesso
+	reply.Mensagem = r.Mensagem
+	reply.Apareceram = r.Apareceram
+	reply.Sumiram = r.Sumiram
+	return nil
+}
+
+// Ping responde imediatamente e guarda o RTT informado pelo cliente JSON-RPC
+func (s *ServidorJSON) Ping(args *PingArgsJSON, reply *PingReplyJSON) error {
+	r := PingReply{}
+	if err := s.jogo.Ping(&PingArgs{JogadorID: args.JogadorID, Sessao: args.Sessao, RTT: time.Duration(args.RTTMs) * time.Millisecond}, &r); err != nil {
+		return err
+	}
+
+	reply.Sucesso = r.Sucesso
+	reply.Mensagem = r.Mensagem
+	return nil
+}
+
+// Sair remove um cliente JSON-RPC do jogo
+func (s *ServidorJSON) Sair(args *SairArgsJSON, reply *SairReplyJSON) error {
+	r := SairReply{}
+	if err := s.jogo.Sair(&SairArgs{JogadorID: args.JogadorID, Sessao: args.Sessao}, &r); err != nil {
+		return err
+	}
+
+	reply.Sucesso = r.Sucesso
+	reply.Mensagem = r.Mensagem
+	return nil
+}
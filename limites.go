@@ -0,0 +1,266 @@
+// limites.go - Limites de comandos por jogador e velocidade máxima
+// Um cliente modificado pode chamar EnviarComando sem parar e andar tão rápido
+// quanto a rede permitir. O servidor limita os comandos de cada jogador com
+// baldes de fichas: um para todos os comandos, um para os movimentos (a
+// velocidade máxima, em células por segundo) e um para cada outro tipo de
+// comando limitado. Cada balde enche na sua taxa até a rajada e cada comando
+// gasta uma ficha; sem ficha, o comando é descartado.
+//
+// Os limites padrão ficam acima da repetição automática de um teclado (cerca
+// de 30 teclas por segundo), e um jogador que segura uma tecla não perde
+// nenhum movimento. Descartes repetidos sobem de nível: depois de
+// -avisar-apos descartes dentro da janela o jogador recebe um aviso na
+// resposta. A expulsão é opcional (-expulsar-apos, desligada por padrão):
+// acontece depois de -expulsar-apos janelas seguidas com aviso, e uma janela
+// sem aviso esquece os anteriores, para que só um abuso contínuo expulse.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ConfigLimites descreve os limites de comandos de cada jogador. Taxas zero
+// desativam o limite correspondente; o valor zero não limita nada.
+type ConfigLimites struct {
+	Comandos         float64       // comandos por segundo, de qualquer tipo
+	RajadaComandos   int           // comandos aceitos de uma vez acima da taxa
+	Velocidade       float64       // movimentos (células) por segundo
+	RajadaMovimentos int           // movimentos aceitos de uma vez acima da velocidade
+	Chat             float64       // mensagens de chat por segundo
+	RajadaChat       int           // mensagens aceitas de uma vez acima da taxa
+	Interacoes       float64       // interações por segundo
+	RajadaInteracoes int           // interações aceitas de uma vez acima da taxa
+	AvisarApos       int           // descartes dentro da janela que geram um aviso (0 nunca avisa)
+	ExpulsarApos     int           // janelas seguidas com aviso depois das quais o jogador é expulso (0 nunca expulsa)
+	Janela           time.Duration // janela de contagem dos descartes
+}
+
+// Ativa indica se algum limite está configurado
+func (c ConfigLimites) Ativa() bool {
+	return c.Comandos > 0 || c.Velocidade > 0 || c.Chat > 0 || c.Interacoes > 0
+}
+
+// registrarFlagsLimites registra as opções dos limites de comandos no
+// conjunto de opções e retorna a configuração que elas preenchem
+func registrarFlagsLimites(fs *flag.FlagSet) *ConfigLimites {
+	c := &ConfigLimites{}
+	fs.Float64Var(&c.Comandos, "limite-comandos", 60, "Comandos por segundo de cada jogador (0 sem limite)")
+	fs.IntVar(&c.RajadaComandos, "rajada-comandos", 30, "Comandos aceitos de uma vez acima de -limite-comandos")
+	fs.Float64Var(&c.Velocidade, "velocidade-maxima", 40, "Velocidade máxima dos jogadores em células por segundo (0 sem limite)")
+	fs.IntVar(&c.RajadaMovimentos, "rajada-movimentos", 20, "Movimentos aceitos de uma vez acima de -velocidade-maxima")
+	fs.Float64Var(&c.Chat, "limite-chat", 2, "Mensagens de chat por segundo de cada jogador (0 sem limite)")
+	fs.IntVar(&c.RajadaChat, "rajada-chat", 5, "Mensagens de chat aceitas de uma vez acima de -limite-chat")
+	fs.Float64Var(&c.Interacoes, "limite-interacoes", 10, "Interações por segundo de cada jogador (0 sem limite)")
+	fs.IntVar(&c.RajadaInteracoes, "rajada-interacoes", 10, "Interações aceitas de uma vez acima de -limite-interacoes")
+	fs.IntVar(&c.AvisarApos, "avisar-apos", 20, "Comandos descartados dentro de -janela-abuso até o jogador ser avisado (0 nunca avisa)")
+	fs.IntVar(&c.ExpulsarApos, "expulsar-apos", 0, "Janelas seguidas com aviso até o jogador ser expulso (0 nunca expulsa)")
+	fs.DurationVar(&c.Janela, "janela-abuso", 10*time.Second, "Janela de contagem dos comandos descartados")
+	return c
+}
+
+// baldeFichas limita uma taxa de eventos permitindo rajadas
+type baldeFichas struct {
+	taxa       float64 // fichas por segundo
+	capacidade float64
+	fichas     float64
+	atualizado time.Time
+}
+
+// novoBalde cria um balde cheio; rajadas menores que 1 valem 1
+func novoBalde(taxa float64, rajada int, agora time.Time) *baldeFichas {
+	capacidade := float64(rajada)
+	if capacidade < 1 {
+		capacidade = 1
+	}
+	return &baldeFichas{taxa: taxa, capacidade: capacidade, fichas: capacidade, atualizado: agora}
+}
+
+// retirar gasta uma ficha, se houver, depois de encher o balde pelo tempo
+// decorrido desde a última retirada
+func (b *baldeFichas) retirar(agora time.Time) bool {
+	b.fichas += agora.Sub(b.atualizado).Seconds() * b.taxa
+	if b.fichas > b.capacidade {
+		b.fichas = b.capacidade
+	}
+	b.atualizado = agora
+	if b.fichas < 1 {
+		return false
+	}
+	b.fichas--
+	return true
+}
+
+// limitesJogador guarda os baldes e o histórico de abuso de um jogador
+type limitesJogador struct {
+	geral   *baldeFichas
+	porTipo map[TipoComando]*baldeFichas
+
+	inicioJanela   time.Time // início da janela de contagem dos descartes
+	descartes      int       // descartes desde inicioJanela ou desde o último aviso
+	avisouNaJanela bool      // se a janela atual já gerou um aviso
+	avisos         int       // janelas seguidas com aviso
+}
+
+// novosLimitesJogador cria os baldes configurados para um jogador
+func novosLimitesJogador(c ConfigLimites, agora time.Time) *limitesJogador {
+	l := &limitesJogador{porTipo: make(map[TipoComando]*baldeFichas)}
+	if c.Comandos > 0 {
+		l.geral = novoBalde(c.Comandos, c.RajadaComandos, agora)
+	}
+	if c.Velocidade > 0 {
+		l.porTipo[ComandoMover] = novoBalde(c.Velocidade, c.RajadaMovimentos, agora)
+	}
+	if c.Chat > 0 {
+		l.porTipo[ComandoChat] = novoBalde(c.Chat, c.RajadaChat, agora)
+	}
+	if c.Interacoes > 0 {
+		l.porTipo[ComandoInteragir] = novoBalde(c.Interacoes, c.RajadaInteracoes, agora)
+	}
+	return l
+}
+
+// permitir gasta as fichas do comando; se faltar alguma, retorna o motivo do
+// descarte. Um comando descartado não gasta ficha de nenhum balde.
+func (l *limitesJogador) permitir(c ConfigLimites, tipo TipoComando, agora time.Time) string {
+	balde := l.porTipo[tipo]
+	if balde != nil && !balde.retirar(agora) {
+		if tipo == ComandoMover {
+			return fmt.Sprintf("velocidade acima de %g células por segundo", c.Velocidade)
+		}
+		return fmt.Sprintf("mais de %g comandos %q por segundo", balde.taxa, tipo.String())
+	}
+	if l.geral != nil && !l.geral.retirar(agora) {
+		if balde != nil {
+			balde.fichas++
+		}
+		return fmt.Sprintf("mais de %g comandos por segundo", c.Comandos)
+	}
+	return ""
+}
+
+// Resposta do servidor a um comando descartado
+type reacaoLimite uint8
+
+const (
+	limiteDescartar reacaoLimite = iota // o comando é apenas descartado
+	limiteAvisar                        // o jogador é avisado
+	limiteExpulsar                      // o jogador é expulso
+)
+
+// contarDescarte registra um comando descartado e decide a reação. Os avisos
+// contam janelas seguidas: a janela que termina sem aviso, ou uma janela
+// inteira sem descartes, zera a contagem. Com várias levas de descartes na
+// mesma janela o jogador é avisado de novo, mas a janela conta uma vez só.
+func (l *limitesJogador) contarDescarte(c ConfigLimites, agora time.Time) reacaoLimite {
+	if c.Janela > 0 && agora.Sub(l.inicioJanela) > c.Janela {
+		if !l.avisouNaJanela || agora.Sub(l.inicioJanela) > 2*c.Janela {
+			l.avisos = 0
+		}
+		l.inicioJanela = agora
+		l.descartes = 0
+		l.avisouNaJanela = false
+	}
+	l.descartes++
+
+	if c.AvisarApos <= 0 || l.descartes < c.AvisarApos {
+		return limiteDescartar
+	}
+	l.descartes = 0
+	if !l.avisouNaJanela {
+		l.avisouNaJanela = true
+		l.avisos++
+	}
+	if c.ExpulsarApos > 0 && l.avisos > c.ExpulsarApos {
+		return limiteExpulsar
+	}
+	return limiteAvisar
+}
+
+// Motivo das expulsões pelos limites de comandos
+const motivoExcessoComandos = "excesso de comandos"
+
+// limitarComando aplica os limites ao comando do jogador. Retorna a mensagem
+// de recusa se o comando foi descartado, ou "" se ele pode ser executado, e
+// se o jogador deve ser expulso; a expulsão fica com quem chama, pois exige o
+// mutex do servidor travado para escrita. Deve ser chamada com o mutex do
+// jogador travado (ou com o do servidor, para escrita).
+func (s *ServidorJogo) limitarComando(j *jogadorServidor, tipo TipoComando) (recusa string, expulsar bool) {
+	if !s.limites.Ativa() {
+		return "", false
+	}
+	agora := time.Now()
+	if j.limites == nil {
+		j.limites = novosLimitesJogador(s.limites, agora)
+	}
+	l := j.limites
+
+	motivo := l.permitir(s.limites, tipo, agora)
+	if motivo == "" {
+		return "", false
+	}
+	s.metricas.registrarDescarte()
+
+	jogador := j.info
+	switch l.contarDescarte(s.limites, agora) {
+	case limiteAvisar:
+		s.metricas.registrarAviso()
+		log.Printf("Jogador %s (ID: %d) avisado por excesso de comandos (%d de %d)", jogador.Nome, jogador.ID, l.avisos, s.limites.ExpulsarApos)
+		aviso := fmt.Sprintf("Aviso: comando descartado, %s. Reduza o ritmo", motivo)
+		if s.limites.ExpulsarApos > 0 {
+			aviso += fmt.Sprintf(" ou será expulso (aviso %d de %d)", l.avisos, s.limites.ExpulsarApos)
+		}
+		return aviso, false
+
+	case limiteExpulsar:
+		return "Você foi expulso do jogo por " + motivoExcessoComandos, true
+	}
+	return "comando descartado: " + motivo, false
+}
+
+// expulsar remove o jogador do jogo como se ele tivesse saído; as chamadas
+// seguintes com o seu ID informam a expulsão. Deve ser chamada com o mutex
+// do servidor travado, e não com o do jogador.
+func (s *ServidorJogo) expulsar(j *jogadorServidor, motivo string) {
+	destravar := s.travarJogador(j)
+	defer destravar()
+	jogador := j.info
+
+	if s.encerrarSessaoConta(j) {
+		s.gravarContas()
+	}
+	s.removerJogador(j)
+	s.expulsos[jogador.ID] = motivo
+	s.estado.Mensagens = append(s.estado.Mensagens, fmt.Sprintf("Jogador %s foi expulso por %s", jogador.Nome, motivo))
+	s.notificar()
+
+	s.registrar(Evento{Tipo: EventoExpulsar, JogadorID: jogador.ID, Motivo: motivo})
+	s.metricas.registrarExpulsao()
+
+	log.Printf("Jogador %s (ID: %d) expulso por %s", jogador.Nome, jogador.ID, motivo)
+}
+
+// expulsarPorID trava o servidor e expulsa o jogador, se ele ainda estiver
+// no jogo, e retorna se estava. Usada pelos movimentos, que decidem a
+// expulsão sem o mutex do servidor, e pelo replay.
+func (s *ServidorJogo) expulsarPorID(id int, motivo string) bool {
+	s.travar()
+	defer s.mutex.Unlock()
+
+	j, existe := s.jogadores[id]
+	if existe {
+		s.expulsar(j, motivo)
+	}
+	return existe
+}
+
+// jogadorAusente retorna a mensagem para chamadas com o ID de um jogador
+// que não está no jogo. Deve ser chamada com o mutex do servidor travado.
+func (s *ServidorJogo) jogadorAusente(id int) string {
+	if motivo, expulso := s.expulsos[id]; expulso {
+		return "Você foi expulso do jogo por " + motivo
+	}
+	return "Jogador não encontrado"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+// limitesPadrao retorna os limites com os valores padrão das opções
+func limitesPadrao(t *testing.T) ConfigLimites {
+	t.Helper()
+	fs := flag.NewFlagSet("teste", flag.ContinueOnError)
+	c := registrarFlagsLimites(fs)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	return *c
+}
+
+// contagemLimites conta as reações a uma sequência de comandos
+type contagemLimites struct {
+	descartes, avisos int
+	expulso           bool
+}
+
+// simularComandos envia comandos do tipo na taxa dada, por duracao a partir
+// de inicio, como limitarComando; para na expulsão
+func simularComandos(c ConfigLimites, l *limitesJogador, tipo TipoComando, taxa float64, inicio time.Time, duracao time.Duration) contagemLimites {
+	var n contagemLimites
+	passo := time.Duration(float64(time.Second) / taxa)
+	for agora := inicio; agora.Before(inicio.Add(duracao)); agora = agora.Add(passo) {
+		if l.permitir(c, tipo, agora) == "" {
+			continue
+		}
+		n.descartes++
+		switch l.contarDescarte(c, agora) {
+		case limiteAvisar:
+			n.avisos++
+		case limiteExpulsar:
+			n.expulso = true
+			return n
+		}
+	}
+	return n
+}
+
+func TestLimitesPadraoAceitamRepeticaoDoTeclado(t *testing.T) {
+	c := limitesPadrao(t)
+	if c.ExpulsarApos != 0 {
+		t.Errorf("expulsão ligada por padrão (-expulsar-apos=%d)", c.ExpulsarApos)
+	}
+
+	// Uma tecla segurada por um minuto com a repetição automática mais
+	// rápida dos sistemas comuns
+	inicio := time.Now()
+	l := novosLimitesJogador(c, inicio)
+	if n := simularComandos(c, l, ComandoMover, 33, inicio, time.Minute); n.descartes != 0 {
+		t.Errorf("%d movimentos descartados segurando uma tecla", n.descartes)
+	}
+}
+
+func TestLimitesExpulsamSoAbusoContinuo(t *testing.T) {
+	c := limitesPadrao(t)
+	c.ExpulsarApos = 3
+	inicio := time.Now()
+
+	// Abuso em rajadas separadas por janelas tranquilas: avisos sem expulsão
+	l := novosLimitesJogador(c, inicio)
+	agora := inicio
+	for i := 0; i < 10; i++ {
+		n := simularComandos(c, l, ComandoMover, 200, agora, 2*time.Second)
+		if n.avisos == 0 || n.expulso {
+			t.Fatalf("rajada %d: %+v", i, n)
+		}
+		agora = agora.Add(2 * time.Second)
+		simularComandos(c, l, ComandoMover, 20, agora, 2*c.Janela)
+		agora = agora.Add(2 * c.Janela)
+	}
+
+	// Abuso contínuo: expulso depois de -expulsar-apos janelas com aviso
+	l = novosLimitesJogador(c, inicio)
+	n := simularComandos(c, l, ComandoMover, 200, inicio, time.Duration(c.ExpulsarApos+2)*c.Janela)
+	if !n.expulso {
+		t.Fatalf("abuso contínuo não foi expulso: %+v", n)
+	}
+	if l.avisos != c.ExpulsarApos+1 {
+		t.Errorf("expulso depois de %d janelas com aviso, esperadas %d", l.avisos, c.ExpulsarApos+1)
+	}
+}
@@ -2,19 +2,97 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
 )
 
 func main() {
 	// Definir flags para modo cliente e servidor
 	modoServidor := flag.Bool("servidor", false, "Iniciar como servidor")
 	porta := flag.String("porta", "8080", "Porta para o servidor")
+	portaJSON := flag.String("porta-json", "", "Porta para o endpoint JSON-RPC do servidor (vazio desativa)")
+	enderecoHTTP := flag.String("http", "", "Endereço da API HTTP e do espectador web, ex. localhost:8090 (vazio desativa)")
 	endereco := flag.String("endereco", "localhost:8080", "Endereço do servidor para conexão do cliente")
 	nome := flag.String("nome", "Jogador", "Nome do jogador")
+	senha := flag.String("senha", "", "Senha da conta do jogador (com -registrar, cria a conta com esta senha)")
+	registrar := flag.Bool("registrar", false, "Criar uma conta com o nome de -nome e a senha de -senha antes de entrar")
 	mapaFile := flag.String("mapa", "mapa.txt", "Arquivo de mapa")
+	arquivoEventos := flag.String("eventos", "", "Arquivo para registrar os eventos do servidor (vazio desativa)")
+	snapshot := flag.String("snapshot", "snapshot.json", "Arquivo do snapshot gravado ao encerrar o servidor (vazio desativa)")
+	arquivoContas := flag.String("contas", "contas.json", "Arquivo das contas de jogadores do servidor (vazio desativa as contas)")
+	contagem := flag.Duration("contagem", 5*time.Second, "Aviso dado aos jogadores antes de encerrar o servidor")
+	hospedar := flag.Bool("hospedar", false, "Iniciar o servidor em segundo plano na porta -porta e jogar nele")
+	logServidor := flag.String("log-servidor", "servidor.log", "Arquivo de log do servidor no modo -hospedar")
+	offline := flag.Bool("offline", false, "Jogar sozinho, sem servidor, com um servidor local em memória")
+	simbolo := flag.String("simbolo", "☺", "Símbolo do jogador (se informado, o menu de escolha não é exibido)")
+	cor := flag.String("cor", "cinza_escuro", "Cor do jogador, ex. verde, azul_claro (se informada, o menu de escolha não é exibido)")
+	telaCliente := flag.String("tela", "termbox", "Interface do cliente: termbox ou ansi (sequências ANSI diretas)")
+	arquivoTeclas := flag.String("teclas", "", "Arquivo de mapeamento de teclas (vazio usa as teclas padrão)")
+	predicao := flag.Bool("predicao", true, "Mover o personagem na hora, sem esperar a resposta do servidor")
+	falhas := registrarFlagsFalhas(flag.CommandLine)
+	limites := registrarFlagsLimites(flag.CommandLine)
+	tamanhoRegiao := flag.Int("regiao", tamanhoRegiaoPadrao, "Lado, em células, das regiões do mapa com trava própria (0 usa uma região só)")
+	raioInteresse := flag.Int("raio-interesse", raioInteressePadrao, "Distância, em células, até a qual cada jogador recebe os outros jogadores (0 envia todos)")
+	flag.DurationVar(&tempoLimiteChamada, "tempo-limite", tempoLimiteChamada, "Tempo máximo de espera por cada resposta do servidor (0 espera para sempre)")
 	
 	flag.Parse()
+	falhasCliente = *falhas
+
+	// Subcomando "replay <arquivo>": reproduz um registro de eventos
+	if flag.Arg(0) == "replay" {
+		if flag.NArg() < 2 {
+			fmt.Fprintln(os.Stderr, "Uso: jogo replay <arquivo>")
+			os.Exit(2)
+		}
+		if err := ExecutarReplay(flag.Arg(1), *mapaFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Erro ao reproduzir eventos: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Subcomando "carga": enxame de bots para teste de carga
+	if flag.Arg(0) == "carga" {
+		if err := ExecutarCarga(flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Erro no teste de carga: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Subcomando "roteiro": cliente sem interface dirigido por comandos
+	if flag.Arg(0) == "roteiro" {
+		err := ExecutarRoteiro(flag.Args()[1:])
+		if errors.Is(err, errAssercao) {
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Erro no roteiro: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Configuração do servidor, usada nos modos -servidor e -hospedar
+	opcoesServidor := OpcoesServidor{
+		Porta:          *porta,
+		Mapa:           *mapaFile,
+		ArquivoEventos: *arquivoEventos,
+		Snapshot:       *snapshot,
+		Contagem:       *contagem,
+		PortaJSON:      *portaJSON,
+		EnderecoHTTP:   *enderecoHTTP,
+		ArquivoContas:  *arquivoContas,
+		Falhas:         *falhas,
+		Limites:        *limites,
+		TamanhoRegiao:  *tamanhoRegiao,
+		RaioInteresse:  *raioInteresse,
+	}
 
 	// Verificar o modo de execução
 	if *modoServidor {
@@ -23,23 +101,152 @@ func main() {
 		fmt.Println("Usando mapa:", *mapaFile)
 		
 		// Iniciar o servidor
-		IniciarServidor(*porta, *mapaFile)
+		IniciarServidor(opcoesServidor)
 	} else {
 		// Modo cliente - inicia o cliente do jogo
-		fmt.Println("Conectando ao servidor:", *endereco)
+		renderizador, err := novoRenderizador(*telaCliente)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		// Aparência pedida nas opções; sem elas, o jogador escolhe em um menu
+		simboloJogador, err := simboloDeTexto(*simbolo)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		corJogador, ok := corPorNome(*cor)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "cor desconhecida: %q\n", *cor)
+			os.Exit(2)
+		}
+		if *arquivoTeclas != "" {
+			mapaTeclas, err := CarregarMapaTeclas(*arquivoTeclas)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Erro ao carregar as teclas: %v\n", err)
+				os.Exit(2)
+			}
+			interfaceDefinirTeclas(mapaTeclas)
+		}
+		mostrarMenu := true
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "simbolo" || f.Name == "cor" {
+				mostrarMenu = false
+			}
+		})
+
+		if *offline && *hospedar {
+			fmt.Fprintln(os.Stderr, "Use -offline ou -hospedar, não ambos")
+			os.Exit(2)
+		}
+		if *offline && *registrar {
+			fmt.Fprintln(os.Stderr, "O modo offline não tem contas; -registrar não pode ser usado")
+			os.Exit(2)
+		}
+
+		if *offline {
+			fmt.Println("Jogando offline com o mapa:", *mapaFile)
+		} else if *hospedar {
+			fmt.Println("Hospedando o jogo na porta:", *porta)
+		} else {
+			fmt.Println("Conectando ao servidor:", *endereco)
+		}
 		fmt.Println("Nome do jogador:", *nome)
 		
-		// Inicializa a interface (termbox)
-		interfaceIniciar()
+		// Se o servidor for encerrado, avisar depois que a interface for finalizada
+		encerrado := false
+		defer func() {
+			if encerrado {
+				fmt.Println("servidor encerrado")
+			}
+		}()
+
+		// No modo hospedar, iniciar o servidor antes da interface; ao sair,
+		// encerrá-lo depois que a interface for finalizada
+		var hospedagem *Hospedagem
+		if *hospedar {
+			hospedagem, err = Hospedar(opcoesServidor, *logServidor)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Erro ao hospedar: %v\n", err)
+				os.Exit(1)
+			}
+			defer func() {
+				fmt.Printf("Encerrando o servidor e avisando os jogadores (%v)...\n", *contagem)
+				if err := hospedagem.Encerrar(); err != nil {
+					fmt.Fprintf(os.Stderr, "Erro ao encerrar o servidor: %v\n", err)
+				}
+			}()
+		}
+
+		// Criar a conta antes de entrar; o jogador entra com ela logo em seguida
+		if *registrar {
+			var nomeConta string
+			if hospedagem != nil {
+				nomeConta, err = RegistrarContaLocal(hospedagem.Servidor, *nome, *senha)
+			} else {
+				nomeConta, err = RegistrarConta(*endereco, *nome, *senha)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return
+			}
+			fmt.Println("Conta criada:", nomeConta)
+			*nome = nomeConta
+		}
+
+		// Inicializa a interface (termbox ou ANSI)
+		interfaceIniciar(renderizador)
 		defer interfaceFinalizar()
 		
-		// Conectar ao servidor
-		cliente, err := NovoCliente(*endereco, *nome, '☺', CorCinzaEscuro)
+		// Conectar ao servidor, ou a um servidor local em memória no modo offline
+		conectar := func(a Aparencia) (*ClienteJogo, error) {
+			args := EntrarArgs{Nome: *nome, Simbolo: a.Simbolo, Cor: a.Cor, Senha: *senha}
+			if *offline {
+				return NovoClienteOffline(*mapaFile, args)
+			}
+			if hospedagem != nil {
+				return NovoClienteLocal(hospedagem.Servidor, args)
+			}
+			return NovoCliente(*endereco, args)
+		}
+		if *offline {
+			// As mensagens de log do servidor local sobrescreveriam a tela
+			log.SetOutput(io.Discard)
+		}
+
+		// Se o servidor recusar o símbolo ou a cor, voltar ao menu com as sugestões
+		aparencia := Aparencia{simboloJogador, corJogador}
+		aviso := ""
+		var sugestoes []Aparencia
+		var cliente *ClienteJogo
+		for {
+			if mostrarMenu {
+				var escolheu bool
+				aparencia, escolheu = interfaceEscolherAparencia(*nome, aparencia, aviso, sugestoes)
+				if !escolheu {
+					return
+				}
+			}
+			cliente, err = conectar(aparencia)
+			var erroAparencia *ErroAparencia
+			if !errors.As(err, &erroAparencia) {
+				break
+			}
+			aviso, sugestoes = erroAparencia.Mensagem, erroAparencia.Sugestoes
+			mostrarMenu = true
+		}
 		if err != nil {
 			fmt.Printf("Erro ao conectar: %v\n", err)
 			return
 		}
 		defer cliente.Sair()
+
+		// Atualizar o estado periodicamente, redesenhando a tela a cada mudança
+		if *predicao {
+			cliente.IniciarPredicao(interfaceInterromperLeitura)
+		}
+		cliente.IniciarAtualizacao(100*time.Millisecond, interfaceInterromperLeitura)
 		
 		// Criar jogo local
 		jogo := jogoNovoMultiplayer(cliente)
@@ -53,7 +260,27 @@ func main() {
 			if continuar := personagemExecutarAcaoMultiplayer(evento, &jogo); !continuar {
 				break
 			}
+			if cliente.ServidorEncerrado() {
+				encerrado = true
+				break
+			}
+			interfaceDesenharJogoMultiplayer(&jogo)
+		}
+
+		// Mostrar o aviso na barra de status antes de sair
+		if encerrado {
 			interfaceDesenharJogoMultiplayer(&jogo)
+			time.Sleep(time.Second)
 		}
 	}
+}
+// Cria o renderizador escolhido com a opção -tela
+func novoRenderizador(nome string) (Renderizador, error) {
+	switch nome {
+	case "termbox":
+		return NovoRenderizadorTermbox(), nil
+	case "ansi":
+		return NovoRenderizadorANSI(), nil
+	}
+	return nil, fmt.Errorf("tela desconhecida %q: use termbox ou ansi", nome)
 }
\ No newline at end of file
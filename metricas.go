@@ -0,0 +1,358 @@
+// metricas.go - Métricas do servidor e verificação de saúde
+// Contadores e histogramas de latência por método RPC, jogadores conectados,
+// comandos por segundo, tempo de espera pelo mutex e bytes enviados por
+// ObterEstado. São expostos em formato texto do Prometheus em /metricas e o
+// estado de saúde em /healthz, no mesmo listener HTTP do espectador.
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/http"
+	"net/rpc"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limites dos baldes dos histogramas
+var (
+	baldesLatencia = []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1}
+	baldesBytes    = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576}
+)
+
+// histograma acumula observações em baldes cumulativos, como no Prometheus
+type histograma struct {
+	mutex    sync.Mutex
+	limites  []float64
+	contagem []uint64 // contagem[i] conta observações <= limites[i]; a última posição é +Inf
+	soma     float64
+	total    uint64
+}
+
+// novoHistograma cria um histograma com os limites informados (em ordem crescente)
+func novoHistograma(limites []float64) *histograma {
+	return &histograma{limites: limites, contagem: make([]uint64, len(limites)+1)}
+}
+
+// observar registra um valor
+func (h *histograma) observar(valor float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	i := sort.SearchFloat64s(h.limites, valor)
+	h.contagem[i]++
+	h.soma += valor
+	h.total++
+}
+
+// escrever emite o histograma no formato texto do Prometheus
+func (h *histograma) escrever(w io.Writer, nome, rotulos string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	separador := ""
+	if rotulos != "" {
+		separador = ","
+	}
+	acumulado := uint64(0)
+	for i, limite := range h.limites {
+		acumulado += h.contagem[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%g\"} %d\n", nome, rotulos, separador, limite, acumulado)
+	}
+	acumulado += h.contagem[len(h.limites)]
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", nome, rotulos, separador, acumulado)
+	if rotulos != "" {
+		rotulos = "{" + rotulos + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", nome, rotulos, h.soma)
+	fmt.Fprintf(w, "%s_count%s %d\n", nome, rotulos, h.total)
+}
+
+// MetricasServidor reúne as métricas coletadas pelo servidor
+type MetricasServidor struct {
+	// Campos de acesso atômico ficam no início para manter o alinhamento de 64 bits
+	comandos           uint64 // total de comandos aceitos
+	comandosPorSegundo uint64 // taxa medida no último segundo
+	comandosAnterior   uint64 // total na última amostragem da taxa
+	descartados        uint64 // comandos descartados pelos limites
+	avisos             uint64 // avisos dados por excesso de comandos
+	expulsoes          uint64 // jogadores expulsos por excesso de comandos
+
+	inicio time.Time
+
+	mutex    sync.Mutex
+	metodos  map[string]*histograma // latência por método RPC
+	chamadas map[string]uint64      // chamadas por método RPC
+
+	esperaTrava *histograma // tempo de espera para obter o mutex do servidor
+	bytesEstado *histograma // bytes de cada resposta de ObterEstado na conexão
+}
+
+// NovasMetricas cria o conjunto de métricas vazio
+func NovasMetricas() *MetricasServidor {
+	return &MetricasServidor{
+		inicio:      time.Now(),
+		metodos:     make(map[string]*histograma),
+		chamadas:    make(map[string]uint64),
+		esperaTrava: novoHistograma(baldesLatencia),
+		bytesEstado: novoHistograma(baldesBytes),
+	}
+}
+
+// registrarChamada contabiliza uma chamada RPC e sua duração
+func (m *MetricasServidor) registrarChamada(metodo string, duracao time.Duration) {
+	m.mutex.Lock()
+	h, existe := m.metodos[metodo]
+	if !existe {
+		h = novoHistograma(baldesLatencia)
+		m.metodos[metodo] = h
+	}
+	m.chamadas[metodo]++
+	m.mutex.Unlock()
+
+	h.observar(duracao.Seconds())
+}
+
+// registrarComando contabiliza um comando aceito
+func (m *MetricasServidor) registrarComando() {
+	atomic.AddUint64(&m.comandos, 1)
+}
+
+// registrarDescarte contabiliza um comando descartado pelos limites
+func (m *MetricasServidor) registrarDescarte() {
+	atomic.AddUint64(&m.descartados, 1)
+}
+
+// registrarAviso contabiliza um aviso por excesso de comandos
+func (m *MetricasServidor) registrarAviso() {
+	atomic.AddUint64(&m.avisos, 1)
+}
+
+// registrarExpulsao contabiliza um jogador expulso
+func (m *MetricasServidor) registrarExpulsao() {
+	atomic.AddUint64(&m.expulsoes, 1)
+}
+
+// amostrarTaxa atualiza comandos por segundo a cada segundo até que parar seja fechado
+func (m *MetricasServidor) amostrarTaxa(parar <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-parar:
+			return
+		case <-ticker.C:
+			total := atomic.LoadUint64(&m.comandos)
+			atomic.StoreUint64(&m.comandosPorSegundo, total-m.comandosAnterior)
+			m.comandosAnterior = total
+		}
+	}
+}
+
+// escritorContado repassa as escritas à conexão contando os bytes
+type escritorContado struct {
+	io.Writer
+	escritos int
+}
+
+func (e *escritorContado) Write(p []byte) (int, error) {
+	n, err := e.Writer.Write(p)
+	e.escritos += n
+	return n, err
+}
+
+// codecMedido envolve o codec de uma conexão RPC e registra quantos bytes
+// cada resposta de ObterEstado ocupou na conexão, sem codificar o estado de
+// novo. O net/rpc escreve uma resposta por vez, então o contador não precisa
+// de trava.
+type codecMedido struct {
+	rpc.ServerCodec
+	saida    *escritorContado
+	metricas *MetricasServidor
+}
+
+// medirCodec cria o codec com novoCodec sobre a conexão, contando os bytes
+// escritos nela
+func (m *MetricasServidor) medirCodec(conn io.ReadWriteCloser, novoCodec func(io.ReadWriteCloser) rpc.ServerCodec) rpc.ServerCodec {
+	saida := &escritorContado{Writer: conn}
+	contada := struct {
+		io.Reader
+		io.Writer
+		io.Closer
+	}{conn, saida, conn}
+	return &codecMedido{ServerCodec: novoCodec(contada), saida: saida, metricas: m}
+}
+
+func (c *codecMedido) WriteResponse(r *rpc.Response, corpo interface{}) error {
+	antes := c.saida.escritos
+	err := c.ServerCodec.WriteResponse(r, corpo)
+	if r.ServiceMethod == "ServidorJogo.ObterEstado" {
+		c.metricas.bytesEstado.observar(float64(c.saida.escritos - antes))
+	}
+	return err
+}
+
+// codecGob é o codec gob do net/rpc (o de rpc.ServeConn, que não é
+// exportado), para que as conexões gob também possam ser medidas
+type codecGob struct {
+	conn  io.ReadWriteCloser
+	dec   *gob.Decoder
+	enc   *gob.Encoder
+	saida *bufio.Writer
+}
+
+func novoCodecGob(conn io.ReadWriteCloser) rpc.ServerCodec {
+	saida := bufio.NewWriter(conn)
+	return &codecGob{conn: conn, dec: gob.NewDecoder(conn), enc: gob.NewEncoder(saida), saida: saida}
+}
+
+func (c *codecGob) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+func (c *codecGob) ReadRequestBody(corpo interface{}) error {
+	return c.dec.Decode(corpo)
+}
+
+func (c *codecGob) WriteResponse(r *rpc.Response, corpo interface{}) error {
+	if err := c.enc.Encode(r); err != nil {
+		c.Close()
+		return err
+	}
+	if err := c.enc.Encode(corpo); err != nil {
+		c.Close()
+		return err
+	}
+	return c.saida.Flush()
+}
+
+func (c *codecGob) Close() error {
+	return c.conn.Close()
+}
+
+// travar obtém o mutex do servidor para escrita, medindo a espera
+func (s *ServidorJogo) travar() {
+	inicio := time.Now()
+	s.mutex.Lock()
+	s.metricas.esperaTrava.observar(time.Since(inicio).Seconds())
+}
+
+// travarLeitura obtém o mutex do servidor para leitura, medindo a espera
+func (s *ServidorJogo) travarLeitura() {
+	inicio := time.Now()
+	s.mutex.RLock()
+	s.metricas.esperaTrava.observar(time.Since(inicio).Seconds())
+}
+
+// escreverMetricas emite todas as métricas no formato texto do Prometheus
+func (s *ServidorJogo) escreverMetricas(w io.Writer) {
+	m := s.metricas
+
+	s.mutex.RLock()
+	jogadores := len(s.jogadores)
+	s.mutex.RUnlock()
+
+	s.controle.Lock()
+	conexoes := len(s.conexoes)
+	emAndamento := s.emAndamento
+	s.controle.Unlock()
+
+	fmt.Fprintln(w, "# HELP jogo_rpc_chamadas_total Chamadas RPC recebidas, por método.")
+	fmt.Fprintln(w, "# TYPE jogo_rpc_chamadas_total counter")
+	m.mutex.Lock()
+	metodos := make([]string, 0, len(m.metodos))
+	for metodo := range m.metodos {
+		metodos = append(metodos, metodo)
+	}
+	sort.Strings(metodos)
+	for _, metodo := range metodos {
+		fmt.Fprintf(w, "jogo_rpc_chamadas_total{metodo=%q} %d\n", metodo, m.chamadas[metodo])
+	}
+	histogramas := make([]*histograma, len(metodos))
+	for i, metodo := range metodos {
+		histogramas[i] = m.metodos[metodo]
+	}
+	m.mutex.Unlock()
+
+	fmt.Fprintln(w, "# HELP jogo_rpc_latencia_segundos Duração das chamadas RPC, por método.")
+	fmt.Fprintln(w, "# TYPE jogo_rpc_latencia_segundos histogram")
+	for i, metodo := range metodos {
+		histogramas[i].escrever(w, "jogo_rpc_latencia_segundos", fmt.Sprintf("metodo=%q", metodo))
+	}
+
+	fmt.Fprintln(w, "# HELP jogo_rpc_em_andamento Chamadas RPC em execução.")
+	fmt.Fprintln(w, "# TYPE jogo_rpc_em_andamento gauge")
+	fmt.Fprintf(w, "jogo_rpc_em_andamento %d\n", emAndamento)
+
+	fmt.Fprintln(w, "# HELP jogo_jogadores_conectados Jogadores no jogo.")
+	fmt.Fprintln(w, "# TYPE jogo_jogadores_conectados gauge")
+	fmt.Fprintf(w, "jogo_jogadores_conectados %d\n", jogadores)
+
+	fmt.Fprintln(w, "# HELP jogo_conexoes_abertas Conexões RPC abertas.")
+	fmt.Fprintln(w, "# TYPE jogo_conexoes_abertas gauge")
+	fmt.Fprintf(w, "jogo_conexoes_abertas %d\n", conexoes)
+
+	fmt.Fprintln(w, "# HELP jogo_comandos_total Comandos de jogadores aceitos.")
+	fmt.Fprintln(w, "# TYPE jogo_comandos_total counter")
+	fmt.Fprintf(w, "jogo_comandos_total %d\n", atomic.LoadUint64(&m.comandos))
+
+	fmt.Fprintln(w, "# HELP jogo_comandos_por_segundo Comandos aceitos no último segundo.")
+	fmt.Fprintln(w, "# TYPE jogo_comandos_por_segundo gauge")
+	fmt.Fprintf(w, "jogo_comandos_por_segundo %d\n", atomic.LoadUint64(&m.comandosPorSegundo))
+
+	fmt.Fprintln(w, "# HELP jogo_comandos_descartados_total Comandos descartados pelos limites de cada jogador.")
+	fmt.Fprintln(w, "# TYPE jogo_comandos_descartados_total counter")
+	fmt.Fprintf(w, "jogo_comandos_descartados_total %d\n", atomic.LoadUint64(&m.descartados))
+
+	fmt.Fprintln(w, "# HELP jogo_avisos_total Avisos dados a jogadores por excesso de comandos.")
+	fmt.Fprintln(w, "# TYPE jogo_avisos_total counter")
+	fmt.Fprintf(w, "jogo_avisos_total %d\n", atomic.LoadUint64(&m.avisos))
+
+	fmt.Fprintln(w, "# HELP jogo_expulsoes_total Jogadores expulsos por excesso de comandos.")
+	fmt.Fprintln(w, "# TYPE jogo_expulsoes_total counter")
+	fmt.Fprintf(w, "jogo_expulsoes_total %d\n", atomic.LoadUint64(&m.expulsoes))
+
+	fmt.Fprintln(w, "# HELP jogo_mutex_espera_segundos Tempo de espera para obter o mutex do servidor.")
+	fmt.Fprintln(w, "# TYPE jogo_mutex_espera_segundos histogram")
+	m.esperaTrava.escrever(w, "jogo_mutex_espera_segundos", "")
+
+	fmt.Fprintln(w, "# HELP jogo_obter_estado_bytes Bytes de cada resposta de ObterEstado enviada pela conexão.")
+	fmt.Fprintln(w, "# TYPE jogo_obter_estado_bytes histogram")
+	m.bytesEstado.escrever(w, "jogo_obter_estado_bytes", "")
+
+	fmt.Fprintln(w, "# HELP jogo_tempo_atividade_segundos Tempo desde o início do servidor.")
+	fmt.Fprintln(w, "# TYPE jogo_tempo_atividade_segundos gauge")
+	fmt.Fprintf(w, "jogo_tempo_atividade_segundos %g\n", time.Since(m.inicio).Seconds())
+}
+
+// registrarRotasMetricas adiciona /metricas e /healthz ao roteador HTTP
+func registrarRotasMetricas(mux *http.ServeMux, s *ServidorJogo) {
+	mux.HandleFunc("/metricas", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.escreverMetricas(w)
+	})
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.RLock()
+		encerrando := s.estado.Encerrando
+		jogadores := len(s.jogadores)
+		s.mutex.RUnlock()
+
+		status := "ok"
+		codigo := http.StatusOK
+		if encerrando {
+			status = "encerrando"
+			codigo = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(codigo)
+		fmt.Fprintf(w, "{\"status\":%q,\"jogadores\":%d,\"atividade_segundos\":%d}\n",
+			status, jogadores, int(time.Since(s.metricas.inicio).Seconds()))
+	})
+}
@@ -0,0 +1,103 @@
+// nomes.go - Nomes de jogadores únicos
+// O servidor limpa o nome pedido em Entrar (remove caracteres de controle e
+// espaços repetidos e limita o tamanho) e não permite dois jogadores com o
+// mesmo nome: um nome repetido recebe um sufixo numérico ("Ana-2"). O nome de
+// uma conta (contas.go) só pode ser usado por quem informar a senha dela.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Tamanho máximo, em caracteres, do nome de um jogador
+const tamanhoMaximoNome = 20
+
+// sanitizarNome remove caracteres invisíveis e espaços repetidos do nome e o
+// limita a tamanhoMaximoNome caracteres. Retorna "" se nada sobrar.
+func sanitizarNome(nome string) string {
+	var sb strings.Builder
+	espaco := false
+	for _, c := range strings.TrimSpace(nome) {
+		switch {
+		case unicode.IsSpace(c):
+			espaco = true
+			continue
+		case !unicode.IsPrint(c):
+			continue
+		}
+		if espaco && sb.Len() > 0 {
+			sb.WriteRune(' ')
+		}
+		espaco = false
+		sb.WriteRune(c)
+	}
+	limpo := []rune(sb.String())
+	if len(limpo) > tamanhoMaximoNome {
+		limpo = limpo[:tamanhoMaximoNome]
+	}
+	return strings.TrimSpace(string(limpo))
+}
+
+// chaveNome normaliza um nome para comparação: "Ana" e "ana" são o mesmo nome
+func chaveNome(nome string) string {
+	return strings.ToLower(nome)
+}
+
+// nomeEmUso indica se algum jogador já usa o nome.
+// Deve ser chamada com o mutex do servidor travado.
+func (s *ServidorJogo) nomeEmUso(nome string) bool {
+	for _, j := range s.jogadores {
+		if chaveNome(j.info.Nome) == chaveNome(nome) {
+			return true
+		}
+	}
+	return false
+}
+
+// nomeLivre retorna o nome, ou o nome com um sufixo numérico, que não esteja
+// em uso nem pertença a uma conta. Deve ser chamada com o mutex do servidor travado.
+func (s *ServidorJogo) nomeLivre(nome string) string {
+	for n := 2; s.nomeEmUso(nome) || s.contas.existe(nome); n++ {
+		sufixo := "-" + strconv.Itoa(n)
+		base := []rune(nome)
+		if len(base)+len(sufixo) > tamanhoMaximoNome {
+			base = base[:tamanhoMaximoNome-len(sufixo)]
+		}
+		nome = string(base) + sufixo
+	}
+	return nome
+}
+
+// escolherNome valida o nome pedido em Entrar e retorna o nome com que o
+// jogador vai entrar e, se ele entrar com uma conta, a conta. Nomes repetidos
+// recebem um sufixo; nomes de contas exigem a senha, já conferida por
+// autenticarConta (autenticada), e não recebem sufixo, pois pertencem a
+// alguém. Deve ser chamada com o mutex do servidor travado.
+func (s *ServidorJogo) escolherNome(args *EntrarArgs, autenticada *Conta) (string, *Conta, error) {
+	nome := sanitizarNome(args.Nome)
+	if nome == "" {
+		return "", nil, errors.New("nome inválido")
+	}
+
+	if s.contas.existe(nome) {
+		conta := s.contas.contas[chaveNome(nome)]
+		if conta != autenticada {
+			return "", nil, fmt.Errorf("o nome %s pertence a uma conta; informe a senha correta", nome)
+		}
+		if s.nomeEmUso(nome) {
+			return "", nil, fmt.Errorf("o nome %s já está em jogo", nome)
+		}
+		return conta.Nome, conta, nil
+	}
+
+	// Sem contas (modo offline) a senha é ignorada
+	if args.Senha != "" && s.contas != nil {
+		return "", nil, fmt.Errorf("não existe conta com o nome %s; registre-a primeiro", nome)
+	}
+
+	return s.nomeLivre(nome), nil, nil
+}
@@ -0,0 +1,139 @@
+// ocupacao.go - Grade de ocupação das células pelos jogadores
+// Verificar se uma célula tem um jogador percorrendo a lista de jogadores
+// custa O(jogadores) por movimento, e procurar a posição inicial célula a
+// célula custa O(células × jogadores) por entrada. O servidor mantém, junto
+// do estado, uma grade com o jogador de cada célula e um conjunto de bits das
+// células livres (transitáveis e desocupadas), atualizados quando um jogador
+// entra, se move ou sai.
+//
+// A consulta de uma célula é O(1). A primeira célula livre é procurada a
+// partir de um índice antes do qual não há nenhuma livre, 64 células por
+// palavra do conjunto de bits; como os jogadores se espalham a partir do
+// início do mapa, a busca em geral para na primeira palavra.
+//
+// Os movimentos de regiões diferentes mudam a grade ao mesmo tempo (ver
+// regioes.go). Cada célula só muda com a trava da sua região, mas uma palavra
+// do conjunto de bits cobre células de mais de uma região, então as palavras
+// e o índice da primeira célula livre são alterados com operações atômicas.
+package main
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// gradeOcupacao registra qual jogador ocupa cada célula do mapa
+type gradeOcupacao struct {
+	primeira        int64 // nenhuma célula antes deste índice está livre (acesso atômico)
+	mapa            [][]Elemento
+	largura, altura int
+	ocupante        []int32  // ID do jogador mais um em cada célula (0 se vazia)
+	livres          []uint64 // bit de cada célula transitável e desocupada (acesso atômico)
+}
+
+// novaGradeOcupacao cria a grade vazia do mapa; as linhas do mapa podem ter
+// tamanhos diferentes e as células além do fim de uma linha nunca ficam livres
+func novaGradeOcupacao(mapa [][]Elemento) *gradeOcupacao {
+	g := &gradeOcupacao{mapa: mapa, altura: len(mapa)}
+	for _, linha := range mapa {
+		if len(linha) > g.largura {
+			g.largura = len(linha)
+		}
+	}
+	celulas := g.largura * g.altura
+	g.ocupante = make([]int32, celulas)
+	g.livres = make([]uint64, (celulas+63)/64)
+	for y, linha := range mapa {
+		for x, elem := range linha {
+			if !elem.Tangivel {
+				g.marcarLivre(y*g.largura + x)
+			}
+		}
+	}
+	return g
+}
+
+// indice retorna a posição da célula nas listas da grade
+func (g *gradeOcupacao) indice(x, y int) (int, bool) {
+	if y < 0 || y >= g.altura || x < 0 || x >= len(g.mapa[y]) {
+		return 0, false
+	}
+	return y*g.largura + x, true
+}
+
+func (g *gradeOcupacao) marcarLivre(i int) {
+	palavra, bit := &g.livres[i/64], uint64(1)<<(uint(i)%64)
+	for {
+		v := atomic.LoadUint64(palavra)
+		if atomic.CompareAndSwapUint64(palavra, v, v|bit) {
+			break
+		}
+	}
+	for {
+		p := atomic.LoadInt64(&g.primeira)
+		if int64(i) >= p || atomic.CompareAndSwapInt64(&g.primeira, p, int64(i)) {
+			break
+		}
+	}
+}
+
+func (g *gradeOcupacao) marcarOcupada(i int) {
+	palavra, bit := &g.livres[i/64], uint64(1)<<(uint(i)%64)
+	for {
+		v := atomic.LoadUint64(palavra)
+		if atomic.CompareAndSwapUint64(palavra, v, v&^bit) {
+			break
+		}
+	}
+}
+
+// ocupanteEm retorna o ID do jogador na célula, se houver algum
+func (g *gradeOcupacao) ocupanteEm(x, y int) (int, bool) {
+	i, ok := g.indice(x, y)
+	if !ok || g.ocupante[i] == 0 {
+		return 0, false
+	}
+	return int(g.ocupante[i]) - 1, true
+}
+
+// ocupar coloca o jogador na célula; posições fora do mapa são ignoradas
+func (g *gradeOcupacao) ocupar(id, x, y int) {
+	if i, ok := g.indice(x, y); ok {
+		g.ocupante[i] = int32(id) + 1
+		g.marcarOcupada(i)
+	}
+}
+
+// liberar retira o jogador da célula, se ele estiver nela
+func (g *gradeOcupacao) liberar(id, x, y int) {
+	i, ok := g.indice(x, y)
+	if !ok || g.ocupante[i] != int32(id)+1 {
+		return
+	}
+	g.ocupante[i] = 0
+	if !g.mapa[y][x].Tangivel {
+		g.marcarLivre(i)
+	}
+}
+
+// mover passa o jogador de uma célula para outra
+func (g *gradeOcupacao) mover(id, x0, y0, x1, y1 int) {
+	g.liberar(id, x0, y0)
+	g.ocupar(id, x1, y1)
+}
+
+// primeiraLivre retorna a primeira célula livre na ordem de leitura do mapa.
+// Deve ser chamada com o mutex do servidor travado para escrita.
+func (g *gradeOcupacao) primeiraLivre() (x, y int, ok bool) {
+	for p := int(atomic.LoadInt64(&g.primeira)) / 64; p < len(g.livres); p++ {
+		palavra := atomic.LoadUint64(&g.livres[p])
+		if palavra == 0 {
+			continue
+		}
+		i := p*64 + bits.TrailingZeros64(palavra)
+		atomic.StoreInt64(&g.primeira, int64(i))
+		return i % g.largura, i / g.largura, true
+	}
+	atomic.StoreInt64(&g.primeira, int64(len(g.livres)*64))
+	return -1, -1, false
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// Mapa gerado dos testes e benchmarks da grade de ocupação
+const (
+	larguraMapaTeste = 400
+	alturaMapaTeste  = 200
+	paredesMapaTeste = 0.2
+)
+
+// Quantidades de jogadores medidas nos benchmarks da grade
+var quantidadesJogadores = []int{10, 100, 500, 1000}
+
+// gerarMapaTeste cria um mapa cercado de paredes com paredes sorteadas no
+// interior
+func gerarMapaTeste(largura, altura int, paredes float64, aleatorio *rand.Rand) [][]Elemento {
+	mapa := make([][]Elemento, altura)
+	for y := range mapa {
+		mapa[y] = make([]Elemento, largura)
+		for x := range mapa[y] {
+			borda := x == 0 || y == 0 || x == largura-1 || y == altura-1
+			if borda || aleatorio.Float64() < paredes {
+				mapa[y][x] = Parede
+			} else {
+				mapa[y][x] = Vazio
+			}
+		}
+	}
+	return mapa
+}
+
+// servidorComJogadores cria um servidor com n jogadores, colocados como o
+// servidor coloca quem entra: cada um na primeira posição livre. Os jogadores
+// são inseridos direto no estado porque Entrar limita as combinações de
+// símbolo e cor.
+func servidorComJogadores(tb testing.TB, mapa [][]Elemento, n int) *ServidorJogo {
+	tb.Helper()
+	s := novoServidorComMapa("", mapa)
+	for id := 0; id < n; id++ {
+		x, y := s.encontrarPosicaoInicial()
+		if x < 0 {
+			tb.Fatalf("o mapa não tem lugar para %d jogadores", n)
+		}
+		s.adicionarJogador(&jogadorServidor{info: JogadorInfo{ID: id, PosX: x, PosY: y, Simbolo: 'b', Nome: fmt.Sprintf("bot-%d", id)}})
+	}
+	s.nextID = n
+	return s
+}
+
+// sortearCelulas sorteia posições do mapa, incluindo algumas fora dele
+func sortearCelulas(largura, altura, quantidade int, aleatorio *rand.Rand) []Posicao {
+	celulas := make([]Posicao, quantidade)
+	for i := range celulas {
+		celulas[i] = Posicao{X: aleatorio.Intn(largura+2) - 1, Y: aleatorio.Intn(altura+2) - 1}
+	}
+	return celulas
+}
+
+// posicaoInicialPorLista é a busca da posição inicial sem a grade: cada
+// célula, na ordem de leitura, é verificada percorrendo os jogadores
+func posicaoInicialPorLista(estado *EstadoJogo) (int, int) {
+	for y := range estado.ElementosMapa {
+		for x := range estado.ElementosMapa[y] {
+			if obstaculoNoEstado(estado, x, y, -1) == "" {
+				return x, y
+			}
+		}
+	}
+	return -1, -1
+}
+
+// conferirGrade verifica se a grade de ocupação responde como a lista de
+// jogadores nas células dadas e na posição inicial
+func conferirGrade(t *testing.T, s *ServidorJogo, celulas []Posicao) {
+	t.Helper()
+	estado := s.copiarEstado()
+	for _, c := range celulas {
+		if lista, grade := obstaculoNoEstado(&estado, c.X, c.Y, -1), s.obstaculoEm(c.X, c.Y); lista != grade {
+			t.Fatalf("célula (%d, %d): lista diz %q, grade diz %q", c.X, c.Y, lista, grade)
+		}
+	}
+	lx, ly := posicaoInicialPorLista(&estado)
+	if gx, gy := s.encontrarPosicaoInicial(); lx != gx || ly != gy {
+		t.Fatalf("posição inicial: lista diz (%d, %d), grade diz (%d, %d)", lx, ly, gx, gy)
+	}
+}
+
+// todasCelulas retorna todas as células do mapa e a borda em volta dele
+func todasCelulas(largura, altura int) []Posicao {
+	var celulas []Posicao
+	for y := -1; y <= altura; y++ {
+		for x := -1; x <= largura; x++ {
+			celulas = append(celulas, Posicao{X: x, Y: y})
+		}
+	}
+	return celulas
+}
+
+func TestGradeIgualALista(t *testing.T) {
+	aleatorio := rand.New(rand.NewSource(1))
+	mapa := gerarMapaTeste(60, 30, paredesMapaTeste, aleatorio)
+	celulas := todasCelulas(60, 30)
+
+	for _, n := range []int{1, 10, 200} {
+		t.Run(fmt.Sprintf("jogadores=%d", n), func(t *testing.T) {
+			s := servidorComJogadores(t, mapa, n)
+			conferirGrade(t, s, celulas)
+
+			// Movimentos e saídas mudam a grade; ela continua igual à lista
+			for i := 0; i < 20*n; i++ {
+				args := EnviarComandoArgs{JogadorID: aleatorio.Intn(n), Comando: NovoComandoMover(DirecaoCima + Direcao(aleatorio.Intn(4)))}
+				s.EnviarComando(&args, &EnviarComandoReply{})
+			}
+			conferirGrade(t, s, celulas)
+
+			for id := 0; id < n; id += 3 {
+				s.Sair(&SairArgs{JogadorID: id}, &SairReply{})
+			}
+			conferirGrade(t, s, celulas)
+		})
+	}
+}
+
+// benchmarkListaEGrade mede a mesma consulta pela lista de jogadores de um
+// EstadoJogo, como o servidor fazia antes da grade, e pela grade de ocupação
+func benchmarkListaEGrade(b *testing.B, lista func(*EstadoJogo, Posicao), grade func(*ServidorJogo, Posicao)) {
+	aleatorio := rand.New(rand.NewSource(1))
+	mapa := gerarMapaTeste(larguraMapaTeste, alturaMapaTeste, paredesMapaTeste, aleatorio)
+	celulas := sortearCelulas(larguraMapaTeste, alturaMapaTeste, 4096, aleatorio)
+
+	for _, n := range quantidadesJogadores {
+		s := servidorComJogadores(b, mapa, n)
+		estado := s.copiarEstado()
+		b.Run(fmt.Sprintf("lista/jogadores=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				lista(&estado, celulas[i%len(celulas)])
+			}
+		})
+		b.Run(fmt.Sprintf("grade/jogadores=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				grade(s, celulas[i%len(celulas)])
+			}
+		})
+	}
+}
+
+// BenchmarkColisao mede o que ocupa uma célula sorteada (um movimento)
+func BenchmarkColisao(b *testing.B) {
+	benchmarkListaEGrade(b,
+		func(estado *EstadoJogo, c Posicao) { obstaculoNoEstado(estado, c.X, c.Y, -1) },
+		func(s *ServidorJogo, c Posicao) { s.obstaculoEm(c.X, c.Y) })
+}
+
+// BenchmarkPosicaoInicial mede a busca da primeira célula livre (uma entrada
+// no jogo)
+func BenchmarkPosicaoInicial(b *testing.B) {
+	benchmarkListaEGrade(b,
+		func(estado *EstadoJogo, _ Posicao) { posicaoInicialPorLista(estado) },
+		func(s *ServidorJogo, _ Posicao) { s.encontrarPosicaoInicial() })
+}
+
+// BenchmarkEnviarComando mede o caminho completo de um movimento
+func BenchmarkEnviarComando(b *testing.B) {
+	mapa := gerarMapaTeste(larguraMapaTeste, alturaMapaTeste, paredesMapaTeste, rand.New(rand.NewSource(1)))
+	for _, n := range quantidadesJogadores {
+		s := servidorComJogadores(b, mapa, n)
+		b.Run(fmt.Sprintf("jogadores=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				args := EnviarComandoArgs{JogadorID: i % n, Comando: NovoComandoMover(DirecaoCima + Direcao(i%4))}
+				s.EnviarComando(&args, &EnviarComandoReply{})
+			}
+		})
+	}
+}
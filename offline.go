@@ -0,0 +1,55 @@
+// offline.go - Modo offline: jogo local sem rede
+// O modo offline cria um ServidorJogo no próprio processo e conecta o cliente
+// a ele por uma conexão em memória (net.Pipe). Assim o jogo local usa
+// exatamente as mesmas regras e o mesmo cliente RPC do jogo multiplayer.
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+)
+
+// NovoClienteOffline cria um servidor local com o mapa informado e retorna
+// um cliente já dentro do jogo, conectado a ele em memória
+func NovoClienteOffline(mapaFile string, args EntrarArgs) (*ClienteJogo, error) {
+	servidor, err := NovoServidor(mapaFile)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao carregar o jogo: %v", err)
+	}
+	return NovoClienteLocal(servidor, args)
+}
+
+// NovoClienteLocal conecta um cliente a um servidor do mesmo processo por
+// uma conexão em memória e entra no jogo
+func NovoClienteLocal(servidor *ServidorJogo, args EntrarArgs) (*ClienteJogo, error) {
+	client, err := conexaoLocal(servidor)
+	if err != nil {
+		return nil, err
+	}
+	return entrarNoJogo(client, args)
+}
+
+// RegistrarContaLocal cria uma conta em um servidor do mesmo processo
+func RegistrarContaLocal(servidor *ServidorJogo, nome, senha string) (string, error) {
+	client, err := conexaoLocal(servidor)
+	if err != nil {
+		return "", err
+	}
+	return registrarConta(client, nome, senha)
+}
+
+// conexaoLocal retorna um cliente RPC ligado ao servidor por uma conexão em memória
+func conexaoLocal(servidor *ServidorJogo) (*rpc.Client, error) {
+	rpcServidor, err := servidor.novoServidorRPC()
+	if err != nil {
+		return nil, err
+	}
+
+	// O servidor atende uma ponta da conexão; a outra fica com o cliente.
+	// Fechar o cliente fecha a conexão e encerra ServeConn.
+	ladoServidor, ladoCliente := net.Pipe()
+	go rpcServidor.ServeConn(ladoServidor)
+
+	return rpc.NewClient(comFalhas(ladoCliente, falhasCliente)), nil
+}
@@ -3,59 +3,71 @@ package main
 
 import "fmt"
 
-// Atualiza a posição do personagem com base na tecla pressionada (WASD)
-func personagemMover(tecla rune, jogo *Jogo) {
-	dx, dy := 0, 0
-	switch tecla {
-	case 'w': dy = -1 // Move para cima
-	case 'a': dx = -1 // Move para a esquerda
-	case 's': dy = 1  // Move para baixo
-	case 'd': dx = 1  // Move para a direita
-	}
+// Quantidade máxima de comandos aguardando envio em segundo plano
+const maximoComandosPendentes = 16
 
-	nx, ny := jogo.PosX+dx, jogo.PosY+dy
-	// Verifica se o movimento é permitido e realiza a movimentação
-	if jogoPodeMoverPara(jogo, nx, ny) {
-		jogoMoverElemento(jogo, jogo.PosX, jogo.PosY, dx, dy)
-		jogo.PosX, jogo.PosY = nx, ny
-	}
+// Comando aguardando envio e o que fazer no jogo quando a resposta chegar
+type comandoPendente struct {
+	comando     Comando
+	aoResponder func(jogo *Jogo, resultado EnviarComandoReply, err error)
 }
 
-// Define o que ocorre quando o jogador pressiona a tecla de interação
-// Neste exemplo, apenas exibe uma mensagem de status
-// Você pode expandir essa função para incluir lógica de interação com objetos
-func personagemInteragir(jogo *Jogo) {
-	// Atualmente apenas exibe uma mensagem de status
-	jogo.StatusMsg = fmt.Sprintf("Interagindo em (%d, %d)", jogo.PosX, jogo.PosY)
+// Coloca o comando na fila de envio sem esperar o servidor; aoResponder é
+// chamada pelo loop principal quando a resposta chegar
+func personagemEnviarComando(jogo *Jogo, comando Comando, aoResponder func(*Jogo, EnviarComandoReply, error)) {
+	select {
+	case jogo.Comandos <- comandoPendente{comando: comando, aoResponder: aoResponder}:
+	default:
+		jogo.Aviso = "Muitos comandos aguardando o servidor"
+	}
 }
 
-// Processa o evento do teclado e executa a ação correspondente
-func personagemExecutarAcao(ev EventoTeclado, jogo *Jogo) bool {
-	switch ev.Tipo {
-	case "sair":
-		// Retorna false para indicar que o jogo deve terminar
-		return false
-	case "interagir":
-		// Executa a ação de interação
-		personagemInteragir(jogo)
-	case "mover":
-		// Move o personagem com base na tecla
-		personagemMover(ev.Tecla, jogo)
+// Envia os comandos da fila, um de cada vez e na ordem, e entrega as
+// respostas ao loop principal, que é acordado para redesenhar a tela
+func personagemEnviarComandos(enviar func(Comando) (EnviarComandoReply, error), comandos <-chan comandoPendente, resultados chan<- func(*Jogo)) {
+	for pendente := range comandos {
+		aoResponder := pendente.aoResponder
+		resultado, err := enviar(pendente.comando)
+		resultados <- func(jogo *Jogo) { aoResponder(jogo, resultado, err) }
+		interfaceInterromperLeitura()
 	}
-	return true // Continua o jogo
 }
 
 // Atualiza a posição do personagem no modo multiplayer
-func personagemMoverMultiplayer(tecla rune, jogo *Jogo) {
+func personagemMoverMultiplayer(direcao Direcao, jogo *Jogo) {
 	if jogo.Cliente == nil {
 		return
 	}
 	
-	// Enviar comando de movimento para o servidor
-	err := jogo.Cliente.EnviarComando("mover", tecla)
-	if err != nil {
-		jogo.StatusMsg = fmt.Sprintf("Erro ao mover: %v", err)
+	// Com a predição ativa o personagem se move na hora; o servidor confirma
+	// ou corrige a posição depois (veja predicao.go)
+	if jogo.Cliente.PredicaoAtiva() {
+		bloqueadoPor, err := jogo.Cliente.MoverComPredicao(direcao)
+		switch {
+		case err != nil:
+			jogo.Aviso = fmt.Sprintf("Erro ao mover: %v", err)
+		case bloqueadoPor != "":
+			jogo.Aviso = "Bloqueado por " + bloqueadoPor
+		default:
+			jogo.Aviso = ""
+		}
+		jogo.PosX, jogo.PosY, _ = jogo.Cliente.PosicaoPrevista()
+		return
 	}
+	
+	// Enviar comando de movimento para o servidor; a resposta já traz a
+	// nova posição e, se o movimento não aconteceu, o que o bloqueou
+	personagemEnviarComando(jogo, NovoComandoMover(direcao), func(jogo *Jogo, resultado EnviarComandoReply, err error) {
+		switch {
+		case err != nil:
+			jogo.Aviso = fmt.Sprintf("Erro ao mover: %v", err)
+		case resultado.Bloqueado:
+			jogo.Aviso = "Bloqueado por " + resultado.BloqueadoPor
+		default:
+			jogo.Aviso = ""
+			jogo.PosX, jogo.PosY = resultado.PosX, resultado.PosY
+		}
+	})
 }
 
 // Define o que ocorre quando o jogador pressiona a tecla de interação no modo multiplayer
@@ -65,19 +77,25 @@ func personagemInteragirMultiplayer(jogo *Jogo) {
 	}
 	
 	// Enviar comando de interação para o servidor
-	err := jogo.Cliente.EnviarComando("interagir", 0)
-	if err != nil {
-		jogo.StatusMsg = fmt.Sprintf("Erro ao interagir: %v", err)
-	} else {
-		jogo.StatusMsg = fmt.Sprintf("Interagindo em (%d, %d)", jogo.PosX, jogo.PosY)
-	}
+	personagemEnviarComando(jogo, NovoComandoInteragir(), func(jogo *Jogo, resultado EnviarComandoReply, err error) {
+		if err != nil {
+			jogo.Aviso = fmt.Sprintf("Erro ao interagir: %v", err)
+		} else {
+			jogo.Aviso = ""
+			jogo.StatusMsg = fmt.Sprintf("Interagindo em (%d, %d)", resultado.PosX, resultado.PosY)
+		}
+	})
 }
 
 // Processa o evento do teclado e executa a ação correspondente no modo multiplayer
 func personagemExecutarAcaoMultiplayer(ev EventoTeclado, jogo *Jogo) bool {
 	switch ev.Tipo {
 	case "sair":
-		// Sair do cliente antes de encerrar
+		// Parar o envio de comandos e sair do cliente antes de encerrar
+		if jogo.Comandos != nil {
+			close(jogo.Comandos)
+			jogo.Comandos = nil
+		}
 		if jogo.Cliente != nil {
 			jogo.Cliente.Sair()
 		}
@@ -87,8 +105,8 @@ func personagemExecutarAcaoMultiplayer(ev EventoTeclado, jogo *Jogo) bool {
 		// Executa a ação de interação
 		personagemInteragirMultiplayer(jogo)
 	case "mover":
-		// Move o personagem com base na tecla
-		personagemMoverMultiplayer(ev.Tecla, jogo)
+		// Move o personagem na direção da tecla
+		personagemMoverMultiplayer(ev.Direcao, jogo)
 	}
 	return true // Continua o jogo
 }
@@ -0,0 +1,237 @@
+// predicao.go - Predição de movimento no cliente com reconciliação
+// Com um servidor remoto, esperar a resposta de cada movimento deixa o
+// personagem parado por um tempo de ida e volta a cada tecla. Com a predição
+// ativa o cliente aplica o movimento na hora, com as mesmas regras de colisão
+// do servidor (obstaculoNoEstado), e o envia numerado com uma sequência.
+//
+// O servidor informa a última sequência aceita de cada jogador e a sua
+// posição. Ao receber essa posição o cliente descarta os movimentos já
+// confirmados, volta à posição do servidor e reaplica os que ainda estão
+// pendentes; se o resultado for diferente do previsto (outro jogador ocupou a
+// célula, por exemplo), a posição exibida é corrigida.
+//
+// Os movimentos são enviados um de cada vez, na ordem, por uma goroutine
+// própria: o servidor atende chamadas RPC em paralelo e recusaria uma
+// sequência que chegasse depois de uma maior.
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// Quantidade máxima de movimentos aguardando envio
+const maximoMovimentosPendentes = 64
+
+// movimentoPendente é um movimento aplicado localmente e ainda não confirmado
+type movimentoPendente struct {
+	sequencia  uint64
+	direcao    Direcao
+	posX, posY int // posição prevista depois do movimento
+}
+
+// Predicao guarda os movimentos previstos de um cliente
+type Predicao struct {
+	mutex sync.Mutex
+	id    int // ID do jogador, ignorado nas colisões com outros jogadores
+
+	sequencia  uint64 // última sequência usada
+	confirmada uint64 // última sequência confirmada pelo servidor
+	pendentes  []movimentoPendente
+	autX, autY int // posição confirmada pelo servidor
+	posX, posY int // posição prevista, com os movimentos pendentes
+	correcoes  int // quantas vezes a previsão foi corrigida
+
+	fila       chan EnviarComandoArgs
+	aoCorrigir func()
+}
+
+// IniciarPredicao ativa a predição de movimento e inicia a goroutine que
+// envia os movimentos ao servidor. aoCorrigir é chamada (se não for nil)
+// quando a posição prevista muda por causa de uma resposta do servidor.
+// Deve ser chamada antes de IniciarAtualizacao, que também reconcilia a
+// predição com os estados recebidos.
+func (c *ClienteJogo) IniciarPredicao(aoCorrigir func()) {
+	conexao := c.conexao
+	if conexao == nil || c.predicao != nil {
+		return
+	}
+
+	jogador := c.Estado().Jogadores[c.ID]
+	p := &Predicao{
+		id:         c.ID,
+		sequencia:  jogador.UltimaSequencia,
+		confirmada: jogador.UltimaSequencia,
+		autX:       c.PosX,
+		autY:       c.PosY,
+		posX:       c.PosX,
+		posY:       c.PosY,
+		fila:       make(chan EnviarComandoArgs, maximoMovimentosPendentes),
+		aoCorrigir: aoCorrigir,
+	}
+	c.predicao = p
+	go c.enviarMovimentos(conexao, p)
+}
+
+// PredicaoAtiva indica se os movimentos do cliente são previstos localmente
+func (c *ClienteJogo) PredicaoAtiva() bool {
+	return c.predicao != nil
+}
+
+// PosicaoPrevista retorna a posição do jogador com os movimentos ainda não
+// confirmados pelo servidor (ok é false sem a predição ativa)
+func (c *ClienteJogo) PosicaoPrevista() (x, y int, ok bool) {
+	p := c.predicao
+	if p == nil {
+		return 0, 0, false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.posX, p.posY, true
+}
+
+// Correcoes retorna quantas vezes a posição prevista foi corrigida pelo servidor
+func (c *ClienteJogo) Correcoes() int {
+	p := c.predicao
+	if p == nil {
+		return 0
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.correcoes
+}
+
+// MoverComPredicao aplica o movimento na posição prevista e o coloca na fila
+// de envio, sem esperar o servidor. Retorna o obstáculo previsto, se o
+// movimento deve ser bloqueado; ainda assim ele é enviado, pois só o
+// servidor sabe se o obstáculo (outro jogador) continua lá.
+func (c *ClienteJogo) MoverComPredicao(direcao Direcao) (bloqueadoPor string, err error) {
+	p := c.predicao
+	if p == nil {
+		return "", errors.New("predição de movimento não está ativa")
+	}
+	if direcao.String() == "" {
+		return "", errors.New("direção inválida")
+	}
+	estado := c.Estado()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	m := movimentoPendente{sequencia: p.sequencia + 1, direcao: direcao}
+	m.posX, m.posY, bloqueadoPor = p.prever(&estado, p.posX, p.posY, direcao)
+
+	args := EnviarComandoArgs{JogadorID: c.ID, Comando: NovoComandoMover(direcao), Sequencia: m.sequencia}
+	select {
+	case p.fila <- args:
+	default:
+		return "", errors.New("muitos movimentos aguardando o servidor")
+	}
+
+	p.sequencia = m.sequencia
+	p.pendentes = append(p.pendentes, m)
+	p.posX, p.posY = m.posX, m.posY
+	return bloqueadoPor, nil
+}
+
+// prever calcula a posição depois de um passo na direção a partir de (x, y),
+// com as mesmas regras de colisão do servidor
+func (p *Predicao) prever(estado *EstadoJogo, x, y int, direcao Direcao) (int, int, string) {
+	dx, dy := direcao.Deslocamento()
+	if obstaculo := obstaculoNoEstado(estado, x+dx, y+dy, p.id); obstaculo != "" {
+		return x, y, obstaculo
+	}
+	return x + dx, y + dy, ""
+}
+
+// reaplicar recalcula a posição prevista a partir da posição confirmada,
+// refazendo os movimentos pendentes. Retorna true se a posição mudou.
+// Deve ser chamada com o mutex da predição travado.
+func (p *Predicao) reaplicar(estado *EstadoJogo) bool {
+	x, y := p.autX, p.autY
+	for i := range p.pendentes {
+		m := &p.pendentes[i]
+		m.posX, m.posY, _ = p.prever(estado, x, y, m.direcao)
+		x, y = m.posX, m.posY
+	}
+
+	mudou := x != p.posX || y != p.posY
+	p.posX, p.posY = x, y
+	if mudou {
+		p.correcoes++
+	}
+	return mudou
+}
+
+// reconciliar aplica a posição informada pelo servidor depois do movimento
+// de sequência seq: descarta os movimentos confirmados e reaplica os
+// pendentes sobre a posição do servidor. Posições de sequências anteriores
+// à última confirmada são ignoradas.
+func (p *Predicao) reconciliar(estado *EstadoJogo, seq uint64, x, y int) {
+	p.mutex.Lock()
+	if seq < p.confirmada {
+		p.mutex.Unlock()
+		return
+	}
+
+	p.confirmada = seq
+	p.autX, p.autY = x, y
+	restantes := p.pendentes[:0]
+	for _, m := range p.pendentes {
+		if m.sequencia > seq {
+			restantes = append(restantes, m)
+		}
+	}
+	p.pendentes = restantes
+	corrigiu := p.reaplicar(estado)
+	p.mutex.Unlock()
+
+	if corrigiu && p.aoCorrigir != nil {
+		p.aoCorrigir()
+	}
+}
+
+// descartar remove um movimento que o servidor não aceitou e reaplica os
+// demais
+func (p *Predicao) descartar(estado *EstadoJogo, seq uint64) {
+	p.mutex.Lock()
+	for i, m := range p.pendentes {
+		if m.sequencia == seq {
+			p.pendentes = append(p.pendentes[:i], p.pendentes[i+1:]...)
+			break
+		}
+	}
+	corrigiu := p.reaplicar(estado)
+	p.mutex.Unlock()
+
+	if corrigiu && p.aoCorrigir != nil {
+		p.aoCorrigir()
+	}
+}
+
+// enviarMovimentos envia os movimentos da fila, um de cada vez, e reconcilia
+// a predição com cada resposta. Termina quando o cliente sai; movimentos
+// ainda na fila são descartados.
+func (c *ClienteJogo) enviarMovimentos(conexao *ClienteRPC, p *Predicao) {
+	for {
+		var args EnviarComandoArgs
+		select {
+		case <-conexao.contexto.Done():
+			return
+		case args = <-p.fila:
+		}
+
+		reply, err := c.enviarPor(conexao, args)
+		conexao.mutex.Lock()
+		estado := conexao.Estado
+		conexao.mutex.Unlock()
+
+		if err != nil {
+			p.descartar(&estado, args.Sequencia)
+			continue
+		}
+		p.reconciliar(&estado, reply.Sequencia, reply.PosX, reply.PosY)
+	}
+}
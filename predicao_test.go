@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Latência simulada em cada sentido nos testes de predição
+const latenciaTeste = 50 * time.Millisecond
+
+// clienteComLatencia conecta um cliente em memória ao servidor passando pelo
+// transporte com falhas, com latenciaTeste em cada sentido
+func clienteComLatencia(t *testing.T, s *ServidorJogo, nome string) *ClienteJogo {
+	t.Helper()
+	anterior := falhasCliente
+	falhasCliente = ConfigFalhas{Latencia: latenciaTeste, Semente: 1}
+	defer func() { falhasCliente = anterior }()
+
+	cliente, err := NovoClienteLocal(s, EntrarArgs{Nome: nome, Simbolo: '@'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cliente.Sair() })
+	return cliente
+}
+
+// posicaoNoServidor retorna a posição do jogador no estado do servidor
+func posicaoNoServidor(t *testing.T, s *ServidorJogo, id int) (int, int) {
+	t.Helper()
+	for _, j := range s.instantaneo().Jogadores {
+		if j.ID == id {
+			return j.PosX, j.PosY
+		}
+	}
+	t.Fatalf("jogador %d não está no servidor", id)
+	return 0, 0
+}
+
+// esperarConfirmacao espera o servidor confirmar todos os movimentos previstos
+func esperarConfirmacao(t *testing.T, c *ClienteJogo) {
+	t.Helper()
+	for limite := time.Now().Add(2 * time.Second); time.Now().Before(limite); time.Sleep(5 * time.Millisecond) {
+		c.predicao.mutex.Lock()
+		pendentes := len(c.predicao.pendentes)
+		c.predicao.mutex.Unlock()
+		if pendentes == 0 {
+			return
+		}
+	}
+	t.Fatal("o servidor não confirmou os movimentos previstos")
+}
+
+func TestPredicaoAntecipaServidor(t *testing.T) {
+	s, err := NovoServidor("mapa.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := clienteComLatencia(t, s, "Ana")
+	c.IniciarPredicao(nil)
+
+	for _, d := range []Direcao{DirecaoDireita, DirecaoDireita, DirecaoBaixo} {
+		if bloqueado, err := c.MoverComPredicao(d); err != nil || bloqueado != "" {
+			t.Fatalf("MoverComPredicao(%v) = %q, %v", d, bloqueado, err)
+		}
+	}
+
+	// A posição prevista muda na hora; o servidor só vê os movimentos depois
+	// da latência
+	if x, y, _ := c.PosicaoPrevista(); x != 3 || y != 2 {
+		t.Errorf("posição prevista = (%d, %d), esperada (3, 2)", x, y)
+	}
+	if x, y := posicaoNoServidor(t, s, c.ID); x != 1 || y != 1 {
+		t.Errorf("servidor já em (%d, %d) antes da latência", x, y)
+	}
+
+	esperarConfirmacao(t, c)
+	if x, y := posicaoNoServidor(t, s, c.ID); x != 3 || y != 2 {
+		t.Errorf("posição no servidor = (%d, %d), esperada (3, 2)", x, y)
+	}
+	if x, y, _ := c.PosicaoPrevista(); x != 3 || y != 2 {
+		t.Errorf("posição prevista depois da confirmação = (%d, %d)", x, y)
+	}
+	if n := c.Correcoes(); n != 0 {
+		t.Errorf("%d correções sem nenhum conflito", n)
+	}
+}
+
+func TestPredicaoCorrigidaPeloServidor(t *testing.T) {
+	s, err := NovoServidor("mapa.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := clienteComLatencia(t, s, "Ana")
+	corrigiu := make(chan struct{}, 1)
+	c.IniciarPredicao(func() {
+		select {
+		case corrigiu <- struct{}{}:
+		default:
+		}
+	})
+
+	// Bruno entra ao lado de Ana depois da última cópia do estado que o
+	// cliente recebeu: a previsão não sabe que a célula está ocupada
+	outro := entrarTeste(t, s, "Bruno", 'B')
+	if x, y := posicaoNoServidor(t, s, outro); x != 2 || y != 1 {
+		t.Fatalf("Bruno entrou em (%d, %d), esperado (2, 1)", x, y)
+	}
+
+	if bloqueado, err := c.MoverComPredicao(DirecaoDireita); err != nil || bloqueado != "" {
+		t.Fatalf("MoverComPredicao = %q, %v", bloqueado, err)
+	}
+	if x, y, _ := c.PosicaoPrevista(); x != 2 || y != 1 {
+		t.Fatalf("posição prevista = (%d, %d), esperada (2, 1)", x, y)
+	}
+
+	esperarConfirmacao(t, c)
+	select {
+	case <-corrigiu:
+	case <-time.After(time.Second):
+		t.Fatal("aoCorrigir não foi chamada")
+	}
+	if x, y, _ := c.PosicaoPrevista(); x != 1 || y != 1 {
+		t.Errorf("posição prevista depois da correção = (%d, %d), esperada (1, 1)", x, y)
+	}
+	if n := c.Correcoes(); n != 1 {
+		t.Errorf("%d correções, esperada 1", n)
+	}
+}
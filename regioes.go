@@ -0,0 +1,298 @@
+// regioes.go - Regiões do mapa com travas próprias para os movimentos
+// Com um único mutex, cada movimento esperava todas as outras chamadas. O
+// mapa é dividido em regiões quadradas (-regiao células de lado), cada uma
+// com a sua trava e o conjunto dos jogadores que estão nela, e um movimento
+// só disputa com os que acontecem nas mesmas regiões. Os movimentos não
+// passam por nenhuma trava global: o jogador é achado em um índice de
+// jogadores publicado a cada entrada e saída (jogadorPorID), a versão do
+// estado é um contador atômico e o registro de eventos é gravado por uma
+// goroutine própria (ver eventos.go). As travas são obtidas sempre na mesma
+// ordem:
+//
+//  1. o mutex do servidor: para escrita por quem muda o conjunto de jogadores
+//     ou as mensagens (entradas, saídas, expulsões, chat, interações), e para
+//     leitura pelas consultas de estado; os movimentos e o Ping não o usam;
+//  2. o mutex do jogador, que ordena os comandos de um mesmo jogador;
+//  3. as travas das regiões, em ordem crescente de índice: a de origem e a de
+//     destino do movimento, as da área de interesse de uma consulta, ou
+//     todas, para uma entrada ou uma cópia do estado inteiro.
+//
+// Como a ordem é a mesma para todos, um movimento entre duas regiões nunca
+// fica esperando outro que espera por ele. Os dados de um jogador só mudam
+// com o seu mutex e a trava da região onde ele está; por isso quem trava as
+// regiões lê os jogadores delas sem ver um movimento pela metade. Uma saída
+// marca o jogador como removido com o seu mutex travado, e um movimento que
+// ainda o achou no índice antigo desiste.
+package main
+
+import "sync"
+
+// Lado padrão das regiões, em células
+const tamanhoRegiaoPadrao = 16
+
+// regiao é um bloco do mapa com trava própria
+type regiao struct {
+	mutex     sync.Mutex
+	jogadores map[int]*jogadorServidor // jogadores na região, muda com mutex travado
+}
+
+// jogadorServidor é o registro de um jogador em jogo no servidor
+type jogadorServidor struct {
+	mutex   sync.Mutex      // ordena os comandos do jogador
+	info    JogadorInfo     // muda com mutex e a trava da região do jogador travados
+	limites *limitesJogador // baldes dos limites de comandos (ver limites.go), criados no primeiro comando
+	sessao  string          // chave da sessão (ver interesse.go), fixa desde a entrada
+
+	// Os campos abaixo mudam com mutex travado
+	removido   bool             // o jogador saiu ou foi expulso
+	movimentos int              // movimentos ainda não somados à conta (ver encerrarSessaoConta)
+	visiveis   map[int]struct{} // jogadores enviados no último estado (ver interesse.go)
+}
+
+// dividirRegioes divide o mapa em regiões de tamanho células de lado; com
+// tamanho 0 o mapa inteiro é uma região só. Deve ser chamada antes de o
+// servidor atender chamadas.
+func (s *ServidorJogo) dividirRegioes(tamanho int) {
+	largura, altura := s.ocupacao.largura, s.ocupacao.altura
+	if tamanho <= 0 {
+		tamanho = largura
+		if altura > tamanho {
+			tamanho = altura
+		}
+		if tamanho == 0 {
+			tamanho = 1
+		}
+	}
+	colunas := (largura + tamanho - 1) / tamanho
+	linhas := (altura + tamanho - 1) / tamanho
+	if colunas == 0 || linhas == 0 {
+		colunas, linhas = 1, 1
+	}
+
+	s.tamanhoRegiao = tamanho
+	s.colunasRegioes = colunas
+	s.regioes = make([]regiao, colunas*linhas)
+	for i := range s.regioes {
+		s.regioes[i].jogadores = make(map[int]*jogadorServidor)
+	}
+	for id, j := range s.jogadores {
+		s.regioes[s.regiaoDe(j.info.PosX, j.info.PosY)].jogadores[id] = j
+	}
+}
+
+// jogadorPorID retorna o jogador com o ID no índice publicado, sem travar o
+// servidor. O jogador pode ter saído depois: confira removido com o mutex do
+// jogador travado.
+func (s *ServidorJogo) jogadorPorID(id int) (*jogadorServidor, bool) {
+	indice, _ := s.indiceJogadores.Load().(map[int]*jogadorServidor)
+	j, existe := indice[id]
+	return j, existe
+}
+
+// publicarJogadores publica uma cópia de jogadores para jogadorPorID. Deve
+// ser chamada com o mutex do servidor travado para escrita, depois de cada
+// entrada ou saída.
+func (s *ServidorJogo) publicarJogadores() {
+	indice := make(map[int]*jogadorServidor, len(s.jogadores))
+	for id, j := range s.jogadores {
+		indice[id] = j
+	}
+	s.indiceJogadores.Store(indice)
+}
+
+// adicionarJogador coloca o jogador no jogo, na posição de j.info. Deve ser
+// chamada com o mutex do servidor travado para escrita e todas as regiões
+// travadas, para que a posição escolhida continue livre.
+func (s *ServidorJogo) adicionarJogador(j *jogadorServidor) {
+	id := j.info.ID
+	s.jogadores[id] = j
+	s.publicarJogadores()
+	s.ocupacao.ocupar(id, j.info.PosX, j.info.PosY)
+	s.regioes[s.regiaoDe(j.info.PosX, j.info.PosY)].jogadores[id] = j
+}
+
+// removerJogador tira o jogador do jogo. Deve ser chamada com o mutex do
+// servidor travado para escrita e o jogador travado com travarJogador.
+func (s *ServidorJogo) removerJogador(j *jogadorServidor) {
+	id := j.info.ID
+	j.removido = true
+	delete(s.jogadores, id)
+	s.publicarJogadores()
+	s.ocupacao.liberar(id, j.info.PosX, j.info.PosY)
+	delete(s.regioes[s.regiaoDe(j.info.PosX, j.info.PosY)].jogadores, id)
+}
+
+// moverNaRegiao atualiza a posição do jogador na grade de ocupação e no
+// conjunto das regiões. Deve ser chamada com o jogador e as regiões de
+// origem e de destino travados.
+func (s *ServidorJogo) moverNaRegiao(j *jogadorServidor, nx, ny int) {
+	x, y := j.info.PosX, j.info.PosY
+	s.ocupacao.mover(j.info.ID, x, y, nx, ny)
+	if origem, destino := s.regiaoDe(x, y), s.regiaoDe(nx, ny); origem != destino {
+		delete(s.regioes[origem].jogadores, j.info.ID)
+		s.regioes[destino].jogadores[j.info.ID] = j
+	}
+	j.info.PosX, j.info.PosY = nx, ny
+}
+
+// regiaoDe retorna o índice da região da célula; células fora do mapa
+// pertencem à região mais próxima
+func (s *ServidorJogo) regiaoDe(x, y int) int {
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+	coluna, linha := x/s.tamanhoRegiao, y/s.tamanhoRegiao
+	if coluna >= s.colunasRegioes {
+		coluna = s.colunasRegioes - 1
+	}
+	if linhas := len(s.regioes) / s.colunasRegioes; linha >= linhas {
+		linha = linhas - 1
+	}
+	return linha*s.colunasRegioes + coluna
+}
+
+// travarRegioes trava as regiões a e b (que podem ser a mesma) em ordem
+// crescente de índice
+func (s *ServidorJogo) travarRegioes(a, b int) {
+	if a > b {
+		a, b = b, a
+	}
+	s.regioes[a].mutex.Lock()
+	if b != a {
+		s.regioes[b].mutex.Lock()
+	}
+}
+
+// destravarRegioes destrava as regiões travadas por travarRegioes
+func (s *ServidorJogo) destravarRegioes(a, b int) {
+	s.regioes[a].mutex.Unlock()
+	if b != a {
+		s.regioes[b].mutex.Unlock()
+	}
+}
+
+// travarTodasRegioes trava todas as regiões, em ordem, para ler todos os
+// jogadores de uma vez
+func (s *ServidorJogo) travarTodasRegioes() {
+	for i := range s.regioes {
+		s.regioes[i].mutex.Lock()
+	}
+}
+
+// destravarTodasRegioes destrava as regiões travadas por travarTodasRegioes
+func (s *ServidorJogo) destravarTodasRegioes() {
+	for i := range s.regioes {
+		s.regioes[i].mutex.Unlock()
+	}
+}
+
+// travarRegioesDoQuadrado trava, em ordem, as regiões que cobrem o quadrado
+// de raio células em volta de (cx, cy) e retorna os seus índices, para
+// destravarRegioesDoQuadrado
+func (s *ServidorJogo) travarRegioesDoQuadrado(cx, cy, raio int) []int {
+	inicio, fim := s.regiaoDe(cx-raio, cy-raio), s.regiaoDe(cx+raio, cy+raio)
+	colunaInicio, colunaFim := inicio%s.colunasRegioes, fim%s.colunasRegioes
+	var indices []int
+	for linha := inicio / s.colunasRegioes; linha <= fim/s.colunasRegioes; linha++ {
+		for coluna := colunaInicio; coluna <= colunaFim; coluna++ {
+			r := linha*s.colunasRegioes + coluna
+			s.regioes[r].mutex.Lock()
+			indices = append(indices, r)
+		}
+	}
+	return indices
+}
+
+// destravarRegioesDoQuadrado destrava as regiões de travarRegioesDoQuadrado
+func (s *ServidorJogo) destravarRegioesDoQuadrado(indices []int) {
+	for _, r := range indices {
+		s.regioes[r].mutex.Unlock()
+	}
+}
+
+// travarJogador trava o jogador e a região onde ele está, para mudar os seus
+// dados sem mudar de região, e retorna a função que destrava os dois
+func (s *ServidorJogo) travarJogador(j *jogadorServidor) (destravar func()) {
+	j.mutex.Lock()
+	r := s.regiaoDe(j.info.PosX, j.info.PosY)
+	s.regioes[r].mutex.Lock()
+	return func() {
+		s.regioes[r].mutex.Unlock()
+		j.mutex.Unlock()
+	}
+}
+
+// moverJogador executa um comando de movimento com o mutex do jogador e as
+// regiões de origem e de destino travados, sem travar o servidor. Uma
+// expulsão pelos limites de comandos é feita depois, com o mutex do servidor
+// travado para escrita.
+func (s *ServidorJogo) moverJogador(args *EnviarComandoArgs, reply *EnviarComandoReply) {
+	// Verificar se o jogador existe e se a chave é a dele; quem não está no
+	// jogo passa pelo mutex do servidor só para saber o motivo
+	j, existe := s.jogadorPorID(args.JogadorID)
+	if existe && !sessaoConfere(j, args.Sessao) {
+		existe = false
+	}
+	if existe {
+		j.mutex.Lock()
+		if j.removido {
+			j.mutex.Unlock()
+			existe = false
+		}
+	}
+	if !existe {
+		s.travarLeitura()
+		reply.Sucesso = false
+		reply.Mensagem = s.jogadorAusente(args.JogadorID)
+		s.mutex.RUnlock()
+		return
+	}
+
+	if aceito, expulsar := s.aceitarComando(j, args, reply); !aceito {
+		j.mutex.Unlock()
+		if expulsar {
+			s.expulsarPorID(args.JogadorID, motivoExcessoComandos)
+		}
+		return
+	}
+
+	x, y := j.info.PosX, j.info.PosY
+	dx, dy := args.Comando.Direcao.Deslocamento()
+	nx, ny := x+dx, y+dy
+	origem, destino := s.regiaoDe(x, y), s.regiaoDe(nx, ny)
+	s.travarRegioes(origem, destino)
+
+	if args.Sequencia != 0 {
+		j.info.UltimaSequencia = args.Sequencia
+		reply.Sequencia = args.Sequencia
+	}
+
+	// Verificar se o movimento é permitido
+	if obstaculo := s.obstaculoEm(nx, ny); obstaculo != "" {
+		reply.Bloqueado = true
+		reply.BloqueadoPor = obstaculo
+	} else {
+		s.moverNaRegiao(j, nx, ny)
+		j.movimentos++
+		s.notificar()
+	}
+
+	// Registrar com as regiões travadas, para que movimentos que dependem
+	// deste recebam um tick maior
+	s.registrar(Evento{Tipo: args.Comando.Tipo.String(), JogadorID: args.JogadorID, Comando: args})
+	reply.PosX, reply.PosY = j.info.PosX, j.info.PosY
+	reply.Versao = s.versaoAtual()
+
+	s.destravarRegioes(origem, destino)
+	j.mutex.Unlock()
+
+	s.metricas.registrarComando()
+	reply.Sucesso = true
+	reply.Mensagem = "Comando processado com sucesso"
+	if reply.Bloqueado {
+		reply.Mensagem = "Movimento bloqueado por " + reply.BloqueadoPor
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Jogadores se movendo ao mesmo tempo em BenchmarkMovimentosConcorrentes
+const movedoresBenchmark = 256
+
+// servidorMovedores cria um servidor dividido em regiões do tamanho dado, com
+// os jogadores em células livres sorteadas, para que se movam em regiões
+// diferentes
+func servidorMovedores(tb testing.TB, mapa [][]Elemento, n, tamanhoRegiao int, aleatorio *rand.Rand) *ServidorJogo {
+	tb.Helper()
+	s := novoServidorComMapa("", mapa)
+	s.dividirRegioes(tamanhoRegiao)
+	largura, altura := s.ocupacao.largura, s.ocupacao.altura
+	for id := 0; id < n; id++ {
+		colocado := false
+		for tentativa := 0; tentativa < 1000 && !colocado; tentativa++ {
+			x, y := aleatorio.Intn(largura), aleatorio.Intn(altura)
+			if s.podeMoverPara(x, y) {
+				s.adicionarJogador(&jogadorServidor{info: JogadorInfo{ID: id, PosX: x, PosY: y, Simbolo: 'b', Nome: fmt.Sprintf("bot-%d", id)}, sessao: sessaoMovedor(id)})
+				colocado = true
+			}
+		}
+		if !colocado {
+			tb.Fatalf("o mapa não tem lugar para %d jogadores", n)
+		}
+	}
+	s.nextID = n
+	return s
+}
+
+// sessaoMovedor é a chave de sessão do jogador id de servidorMovedores
+func sessaoMovedor(id int) string {
+	return fmt.Sprintf("sessao-%d", id)
+}
+
+// moverEmParalelo faz total movimentos divididos entre as goroutines dos
+// jogadores; cada jogador anda para um lado e volta e, com consultas maior
+// que zero, consulta o estado a cada consultas movimentos, como um cliente
+// que recebe o estado enquanto anda
+func moverEmParalelo(s *ServidorJogo, jogadores, total, consultas int) {
+	var feitos int64
+	var wg sync.WaitGroup
+	for id := 0; id < jogadores; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			args := EnviarComandoArgs{JogadorID: id, Sessao: sessaoMovedor(id)}
+			consulta := ObterEstadoArgs{JogadorID: id, Sessao: sessaoMovedor(id)}
+			for passo := 0; atomic.AddInt64(&feitos, 1) <= int64(total); passo++ {
+				direcao := DirecaoDireita
+				if passo%2 == 1 {
+					direcao = DirecaoEsquerda
+				}
+				args.Comando = NovoComandoMover(direcao)
+				s.EnviarComando(&args, &EnviarComandoReply{})
+				if consultas > 0 && passo%consultas == 0 {
+					s.ObterEstado(&consulta, &ObterEstadoReply{})
+				}
+			}
+		}(id)
+	}
+	wg.Wait()
+}
+
+// BenchmarkMovimentosConcorrentes mede a vazão de movimentos de jogadores
+// espalhados pelo mapa, cada um na sua goroutine, com uma região só (que
+// enfileira os movimentos como um único mutex) e com regiões menores. O
+// cenário "servidor" grava o registro de eventos e cada jogador consulta o
+// estado da sua área de interesse a cada 10 movimentos, como num servidor de
+// verdade. O ganho das regiões depende de haver mais de uma CPU; use -cpu
+// para comparar.
+func BenchmarkMovimentosConcorrentes(b *testing.B) {
+	mapa := gerarMapaTeste(larguraMapaTeste, alturaMapaTeste, paredesMapaTeste, rand.New(rand.NewSource(1)))
+	for _, servidor := range []bool{false, true} {
+		for _, tamanho := range []int{0, 64, 16} {
+			nome := fmt.Sprintf("regiao=%d", tamanho)
+			if tamanho == 0 {
+				nome = "regiao=mapa-todo"
+			}
+			consultas := 0
+			if servidor {
+				nome = "servidor/" + nome
+				consultas = 10
+			}
+			b.Run(nome, func(b *testing.B) {
+				// Cada cenário começa com os jogadores nas mesmas posições
+				s := servidorMovedores(b, mapa, movedoresBenchmark, tamanho, rand.New(rand.NewSource(2)))
+				if servidor {
+					s.raioInteresse = raioInteressePadrao
+					if err := s.ativarRegistro(filepath.Join(b.TempDir(), "eventos.log")); err != nil {
+						b.Fatal(err)
+					}
+					defer s.registro.Fechar()
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				moverEmParalelo(s, movedoresBenchmark, b.N, consultas)
+			})
+		}
+	}
+}
+
+// TestMovimentosConcorrentesReproduziveis mistura movimentos, consultas,
+// pings, chat, interações e saídas de muitos jogadores ao mesmo tempo e
+// confere que a grade e as regiões continuam de acordo com os jogadores e
+// que o replay do registro chega ao mesmo estado. Rode com -race.
+func TestMovimentosConcorrentesReproduziveis(t *testing.T) {
+	arquivo := filepath.Join(t.TempDir(), "eventos.log")
+	s, err := prepararServidor(OpcoesServidor{
+		Mapa:           "mapa.txt",
+		ArquivoEventos: arquivo,
+		TamanhoRegiao:  8,
+		RaioInteresse:  5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simbolos := []rune("abcdefghijklmnopqrstuvwxyz")
+	var ids []int
+	sessoes := make(map[int]string)
+	for i := 0; i < 60; i++ {
+		reply := EntrarReply{}
+		s.Entrar(&EntrarArgs{Nome: "bot", Simbolo: simbolos[i%len(simbolos)], Cor: nomesCores[i/len(simbolos)].Cor}, &reply)
+		if !reply.Sucesso {
+			t.Fatalf("entrada %d recusada: %s", i, reply.Mensagem)
+		}
+		ids = append(ids, reply.JogadorID)
+		sessoes[reply.JogadorID] = reply.Sessao
+	}
+
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i, id int, sessao string) {
+			defer wg.Done()
+			aleatorio := rand.New(rand.NewSource(int64(i)))
+			for passo := 0; passo < 400; passo++ {
+				var comando Comando
+				switch aleatorio.Intn(20) {
+				case 0:
+					s.ObterEstado(&ObterEstadoArgs{JogadorID: id, Sessao: sessao}, &ObterEstadoReply{})
+					continue
+				case 1:
+					s.Ping(&PingArgs{JogadorID: id, Sessao: sessao, RTT: time.Duration(1+aleatorio.Intn(3)) * time.Millisecond}, &PingReply{})
+					continue
+				case 2:
+					comando = NovoComandoChat("oi")
+				case 3:
+					comando = NovoComandoInteragir()
+				default:
+					comando = NovoComandoMover(DirecaoCima + Direcao(aleatorio.Intn(4)))
+				}
+				s.EnviarComando(&EnviarComandoArgs{JogadorID: id, Sessao: sessao, Comando: comando}, &EnviarComandoReply{})
+			}
+			if i%7 == 0 {
+				s.Sair(&SairArgs{JogadorID: id, Sessao: sessao}, &SairReply{})
+			}
+		}(i, id, sessoes[id])
+	}
+	wg.Wait()
+	s.registro.Fechar()
+
+	conferirGrade(t, s, todasCelulas(s.ocupacao.largura, s.ocupacao.altura))
+	naRegiao := 0
+	for r := range s.regioes {
+		for id, j := range s.regioes[r].jogadores {
+			if s.jogadores[id] != j || s.regiaoDe(j.info.PosX, j.info.PosY) != r {
+				t.Errorf("jogador %d fora do lugar na região %d", id, r)
+			}
+			naRegiao++
+		}
+	}
+	if naRegiao != len(s.jogadores) {
+		t.Errorf("%d jogadores nas regiões, esperado %d", naRegiao, len(s.jogadores))
+	}
+
+	reproduzido, err := reproduzirEventos(arquivo, "mapa.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, copia := s.instantaneo(), reproduzido.instantaneo()
+	if !reflect.DeepEqual(original, copia) {
+		t.Errorf("replay divergiu:\noriginal %+v\nreplay   %+v", original, copia)
+	}
+	if len(original.Jogadores) == 0 {
+		t.Error("todos os jogadores saíram; o teste não conferiu posições")
+	}
+	if original.Tick < uint64(len(ids)*100) {
+		t.Errorf("só %d eventos registrados; os comandos foram recusados", original.Tick)
+	}
+}
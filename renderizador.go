@@ -0,0 +1,157 @@
+// renderizador.go - Abstração da tela usada pela interface do jogo
+// A interface desenha células (símbolo, cor e cor de fundo) e lê eventos de
+// entrada através de um Renderizador. A implementação com termbox fica em
+// renderizador_termbox.go e uma implementação em memória, que guarda os
+// quadros como texto, fica em renderizador_memoria.go. Assim os tipos do
+// jogo não dependem de termbox e a interface pode rodar sem terminal.
+package main
+
+import "strconv"
+
+// Cor representa uma cor de terminal: a cor básica nos bits baixos e
+// atributos (negrito, tênue, ...) combinados com |
+type Cor uint16
+
+// Cores básicas
+const (
+	CorPadrao Cor = iota
+	CorPreto
+	CorVermelho
+	CorVerde
+	CorAmarelo
+	CorAzul
+	CorMagenta
+	CorCiano
+	CorBranco
+	CorCinzaEscuro
+	CorVermelhoClaro
+	CorVerdeClaro
+	CorAmareloClaro
+	CorAzulClaro
+	CorMagentaClaro
+	CorCianoClaro
+	CorCinzaClaro
+)
+
+// Atributos que podem ser combinados com uma cor básica
+const (
+	AtributoNegrito Cor = 1 << (iota + 9)
+	AtributoPiscante
+	AtributoOculto
+	AtributoTenue
+	AtributoSublinhado
+	AtributoItalico
+	AtributoInverso
+
+	mascaraCorBasica Cor = 1<<9 - 1
+)
+
+// Cores utilizadas no jogo
+const (
+	CorParede      = CorPreto | AtributoNegrito | AtributoTenue
+	CorFundoParede = CorCinzaEscuro
+	CorTexto       = CorCinzaEscuro
+)
+
+// nomesCores associa nomes neutros de linguagem às cores básicas do terminal.
+// Usado onde a cor precisa ser escrita como texto (JSON-RPC, linha de comando).
+var nomesCores = []struct {
+	Nome string
+	Cor  Cor
+}{
+	{"padrao", CorPadrao},
+	{"preto", CorPreto},
+	{"vermelho", CorVermelho},
+	{"verde", CorVerde},
+	{"amarelo", CorAmarelo},
+	{"azul", CorAzul},
+	{"magenta", CorMagenta},
+	{"ciano", CorCiano},
+	{"branco", CorBranco},
+	{"cinza_escuro", CorCinzaEscuro},
+	{"vermelho_claro", CorVermelhoClaro},
+	{"verde_claro", CorVerdeClaro},
+	{"amarelo_claro", CorAmareloClaro},
+	{"azul_claro", CorAzulClaro},
+	{"magenta_claro", CorMagentaClaro},
+	{"ciano_claro", CorCianoClaro},
+	{"cinza_claro", CorCinzaClaro},
+}
+
+// Retorna o nome de uma cor; cores fora da tabela são escritas pelo valor numérico
+func corNome(cor Cor) string {
+	for _, c := range nomesCores {
+		if c.Cor == cor {
+			return c.Nome
+		}
+	}
+	return strconv.FormatUint(uint64(cor), 10)
+}
+
+// Converte um nome (ou valor numérico) de volta para a cor correspondente
+func corPorNome(nome string) (Cor, bool) {
+	for _, c := range nomesCores {
+		if c.Nome == nome {
+			return c.Cor, true
+		}
+	}
+	if valor, err := strconv.ParseUint(nome, 10, 16); err == nil {
+		return Cor(valor), true
+	}
+	return CorPadrao, false
+}
+
+// TipoEntrada identifica o tipo de um EventoEntrada
+type TipoEntrada int
+
+const (
+	EntradaNenhuma       TipoEntrada = iota // evento sem interesse para o jogo
+	EntradaTecla                            // tecla pressionada
+	EntradaInterrupcao                      // leitura interrompida por Interromper
+	EntradaRedimensionar                    // o terminal mudou de tamanho
+)
+
+// Tecla identifica teclas especiais, que não produzem um caractere
+type Tecla int
+
+const (
+	TeclaNenhuma Tecla = iota // tecla comum: o caractere está em EventoEntrada.Ch
+	TeclaEsc
+	TeclaEnter
+	TeclaBackspace
+	TeclaTab
+	TeclaEspaco
+	TeclaSetaCima
+	TeclaSetaBaixo
+	TeclaSetaEsquerda
+	TeclaSetaDireita
+)
+
+// EventoEntrada é um evento bruto de entrada lido pelo renderizador
+type EventoEntrada struct {
+	Tipo  TipoEntrada
+	Tecla Tecla // tecla especial, ou TeclaNenhuma
+	Ch    rune  // caractere digitado, quando Tecla == TeclaNenhuma
+}
+
+// Renderizador é a tela onde a interface desenha e de onde lê a entrada.
+// As células são desenhadas em um buffer e só aparecem após Atualizar.
+type Renderizador interface {
+	// Iniciar prepara a tela para uso
+	Iniciar() error
+	// Finalizar restaura a tela ao estado original
+	Finalizar()
+	// Tamanho retorna a largura e a altura da tela, em células
+	Tamanho() (int, int)
+	// Limpar apaga o buffer de desenho
+	Limpar()
+	// DefinirCelula desenha um símbolo na posição (x, y) do buffer
+	DefinirCelula(x, y int, ch rune, cor, fundo Cor)
+	// Atualizar exibe o conteúdo do buffer
+	Atualizar() error
+	// LerEvento bloqueia até o próximo evento de entrada
+	LerEvento() EventoEntrada
+	// Interromper faz uma chamada pendente de LerEvento retornar
+	// EntradaInterrupcao; pode ser chamada de outra goroutine
+	Interromper()
+}
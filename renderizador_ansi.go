@@ -0,0 +1,344 @@
+// renderizador_ansi.go - Renderizador que escreve sequências ANSI diretamente
+// Alternativa ao termbox para terminais onde ele não funciona bem. Mantém uma
+// cópia do que está na tela e, a cada Atualizar, reescreve apenas as células
+// que mudaram. O terminal é colocado em modo raw com o comando stty e as teclas
+// são lidas diretamente da entrada padrão.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Tempo de espera pelo restante de uma sequência de escape (ex. setas)
+	// antes de tratar ESC como uma tecla isolada
+	esperaSequenciaEscape = 30 * time.Millisecond
+
+	// Intervalo mínimo entre consultas ao tamanho do terminal
+	intervaloConsultaTamanho = time.Second
+)
+
+// RenderizadorANSI desenha no terminal com sequências de escape ANSI
+type RenderizadorANSI struct {
+	entrada *os.File
+	saida   *bufio.Writer
+
+	sttyOriginal string // configuração do terminal restaurada em Finalizar
+
+	largura         int
+	altura          int
+	consultaTamanho time.Time  // última consulta ao tamanho do terminal
+	buffer          [][]Celula // quadro sendo desenhado
+	tela            [][]Celula // o que está visível no terminal
+	repintar        bool       // redesenhar todas as células no próximo Atualizar
+
+	runas   chan rune // caracteres lidos da entrada padrão
+	eventos chan EventoEntrada
+}
+
+// NovoRenderizadorANSI cria o renderizador ANSI sobre a entrada e saída padrão
+func NovoRenderizadorANSI() *RenderizadorANSI {
+	return &RenderizadorANSI{
+		entrada: os.Stdin,
+		saida:   bufio.NewWriter(os.Stdout),
+		eventos: make(chan EventoEntrada, 16),
+	}
+}
+
+// stty executa o comando stty sobre o terminal da entrada padrão
+func (r *RenderizadorANSI) stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = r.entrada
+	saida, err := cmd.Output()
+	return strings.TrimSpace(string(saida)), err
+}
+
+// tamanhoTerminal consulta o tamanho do terminal; sem resposta assume 80x24
+func (r *RenderizadorANSI) tamanhoTerminal() (int, int) {
+	saida, err := r.stty("size")
+	if err == nil {
+		campos := strings.Fields(saida)
+		if len(campos) == 2 {
+			linhas, errL := strconv.Atoi(campos[0])
+			colunas, errC := strconv.Atoi(campos[1])
+			if errL == nil && errC == nil && linhas > 0 && colunas > 0 {
+				return colunas, linhas
+			}
+		}
+	}
+	return 80, 24
+}
+
+func (r *RenderizadorANSI) Iniciar() error {
+	original, err := r.stty("-g")
+	if err != nil {
+		return fmt.Errorf("não foi possível ler a configuração do terminal (stty): %v", err)
+	}
+	if _, err := r.stty("raw", "-echo"); err != nil {
+		return fmt.Errorf("não foi possível colocar o terminal em modo raw (stty): %v", err)
+	}
+	r.sttyOriginal = original
+
+	r.largura, r.altura = r.tamanhoTerminal()
+	r.consultaTamanho = time.Now()
+	r.buffer = novaGrade(r.largura, r.altura)
+	r.tela = novaGrade(r.largura, r.altura)
+
+	// Tela alternativa, cursor oculto e tela limpa
+	r.saida.WriteString("\x1b[?1049h\x1b[?25l\x1b[0m\x1b[2J")
+	if err := r.saida.Flush(); err != nil {
+		return err
+	}
+
+	r.runas = make(chan rune, 64)
+	go r.lerRunas()
+	go r.traduzirEntrada()
+	return nil
+}
+
+func (r *RenderizadorANSI) Finalizar() {
+	// Restaurar atributos, cursor e tela principal
+	r.saida.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+	r.saida.Flush()
+	if r.sttyOriginal != "" {
+		r.stty(r.sttyOriginal)
+	}
+}
+
+func (r *RenderizadorANSI) Tamanho() (int, int) {
+	return r.largura, r.altura
+}
+
+func (r *RenderizadorANSI) Limpar() {
+	r.buffer = novaGrade(r.largura, r.altura)
+}
+
+func (r *RenderizadorANSI) DefinirCelula(x, y int, ch rune, cor, fundo Cor) {
+	if y < 0 || y >= r.altura || x < 0 || x >= r.largura {
+		return
+	}
+	r.buffer[y][x] = Celula{Ch: ch, Cor: cor, Fundo: fundo}
+}
+
+func (r *RenderizadorANSI) Atualizar() error {
+	// Se o terminal mudou de tamanho, o conteúdo visível é desconhecido
+	if time.Since(r.consultaTamanho) >= intervaloConsultaTamanho {
+		r.consultaTamanho = time.Now()
+		if largura, altura := r.tamanhoTerminal(); largura != r.largura || altura != r.altura {
+			r.redimensionar(largura, altura)
+		}
+	}
+	if r.repintar {
+		r.saida.WriteString("\x1b[0m\x1b[2J")
+	}
+
+	cursorX, cursorY := -1, -1
+	estilo := ""
+	for y := range r.buffer {
+		for x, c := range r.buffer[y] {
+			if !r.repintar && r.tela[y][x] == c {
+				continue
+			}
+			if x != cursorX || y != cursorY {
+				fmt.Fprintf(r.saida, "\x1b[%d;%dH", y+1, x+1)
+			}
+			if novo := sequenciaEstilo(c.Cor, c.Fundo); novo != estilo {
+				r.saida.WriteString(novo)
+				estilo = novo
+			}
+			r.saida.WriteRune(c.Ch)
+			r.tela[y][x] = c
+			cursorX, cursorY = x+1, y
+			if c.Ch > 0x7f {
+				// A largura exibida de caracteres não ASCII varia entre
+				// terminais; reposicionar o cursor na próxima célula
+				cursorX = -1
+			}
+		}
+	}
+	r.repintar = false
+
+	r.saida.WriteString("\x1b[0m")
+	return r.saida.Flush()
+}
+
+// redimensionar ajusta as grades ao novo tamanho, preservando o desenho atual
+func (r *RenderizadorANSI) redimensionar(largura, altura int) {
+	buffer := novaGrade(largura, altura)
+	for y := 0; y < altura && y < r.altura; y++ {
+		for x := 0; x < largura && x < r.largura; x++ {
+			buffer[y][x] = r.buffer[y][x]
+		}
+	}
+	r.largura, r.altura = largura, altura
+	r.buffer = buffer
+	r.tela = novaGrade(largura, altura)
+	r.repintar = true
+}
+
+func (r *RenderizadorANSI) LerEvento() EventoEntrada {
+	return <-r.eventos
+}
+
+func (r *RenderizadorANSI) Interromper() {
+	// Se a fila estiver cheia já há eventos pendentes e a leitura retornará
+	select {
+	case r.eventos <- EventoEntrada{Tipo: EntradaInterrupcao}:
+	default:
+	}
+}
+
+// lerRunas lê caracteres UTF-8 da entrada padrão até o fim da entrada
+func (r *RenderizadorANSI) lerRunas() {
+	leitor := bufio.NewReader(r.entrada)
+	for {
+		ch, _, err := leitor.ReadRune()
+		if err != nil {
+			close(r.runas)
+			return
+		}
+		r.runas <- ch
+	}
+}
+
+// traduzirEntrada converte os caracteres lidos em eventos de teclado,
+// reconhecendo as sequências de escape das setas
+func (r *RenderizadorANSI) traduzirEntrada() {
+	for ch := range r.runas {
+		if ch != 0x1b {
+			r.eventos <- eventoDeRuna(ch)
+			continue
+		}
+
+		// ESC: pode ser a tecla isolada ou o início de uma sequência
+		sequencia := r.lerSequenciaEscape()
+		if tecla, existe := sequenciasSetas[sequencia]; existe {
+			r.eventos <- EventoEntrada{Tipo: EntradaTecla, Tecla: tecla}
+		} else if sequencia == "" {
+			r.eventos <- EventoEntrada{Tipo: EntradaTecla, Tecla: TeclaEsc}
+		}
+		// Outras sequências (teclas de função etc.) são ignoradas
+	}
+
+	// Fim da entrada padrão: tratar como pedido de saída
+	r.eventos <- EventoEntrada{Tipo: EntradaTecla, Tecla: TeclaEsc}
+}
+
+// lerSequenciaEscape lê o restante de uma sequência iniciada por ESC.
+// Retorna "" se nada chegar logo após o ESC.
+func (r *RenderizadorANSI) lerSequenciaEscape() string {
+	var sb strings.Builder
+	for {
+		select {
+		case ch, ok := <-r.runas:
+			if !ok {
+				return sb.String()
+			}
+			sb.WriteRune(ch)
+			// "[" e "O" iniciam a sequência; a primeira letra seguinte a termina
+			if sb.Len() > 1 && (ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch == '~') {
+				return sb.String()
+			}
+			if sb.Len() == 1 && ch != '[' && ch != 'O' {
+				return sb.String()
+			}
+		case <-time.After(esperaSequenciaEscape):
+			return sb.String()
+		}
+	}
+}
+
+// Sequências enviadas pelas setas (modo normal e modo aplicação)
+var sequenciasSetas = map[string]Tecla{
+	"[A": TeclaSetaCima,
+	"[B": TeclaSetaBaixo,
+	"[C": TeclaSetaDireita,
+	"[D": TeclaSetaEsquerda,
+	"OA": TeclaSetaCima,
+	"OB": TeclaSetaBaixo,
+	"OC": TeclaSetaDireita,
+	"OD": TeclaSetaEsquerda,
+}
+
+// eventoDeRuna converte um caractere lido em modo raw em um EventoEntrada
+func eventoDeRuna(ch rune) EventoEntrada {
+	switch ch {
+	case 0x03: // Ctrl+C não gera sinal em modo raw; tratar como ESC
+		return EventoEntrada{Tipo: EntradaTecla, Tecla: TeclaEsc}
+	case '\r', '\n':
+		return EventoEntrada{Tipo: EntradaTecla, Tecla: TeclaEnter}
+	case 0x7f, 0x08:
+		return EventoEntrada{Tipo: EntradaTecla, Tecla: TeclaBackspace}
+	case '\t':
+		return EventoEntrada{Tipo: EntradaTecla, Tecla: TeclaTab}
+	case ' ':
+		return EventoEntrada{Tipo: EntradaTecla, Tecla: TeclaEspaco}
+	}
+	if ch < 0x20 {
+		return EventoEntrada{Tipo: EntradaNenhuma}
+	}
+	return EventoEntrada{Tipo: EntradaTecla, Ch: ch}
+}
+
+// sequenciaEstilo monta a sequência SGR para a cor do texto e do fundo
+func sequenciaEstilo(cor, fundo Cor) string {
+	codigos := []string{"0"}
+	atributos := []struct {
+		cor    Cor
+		codigo string
+	}{
+		{AtributoNegrito, "1"},
+		{AtributoTenue, "2"},
+		{AtributoItalico, "3"},
+		{AtributoSublinhado, "4"},
+		{AtributoPiscante, "5"},
+		{AtributoInverso, "7"},
+		{AtributoOculto, "8"},
+	}
+	for _, a := range atributos {
+		if cor&a.cor != 0 {
+			codigos = append(codigos, a.codigo)
+		}
+	}
+	if c := codigoCorANSI(cor, 30); c != "" {
+		codigos = append(codigos, c)
+	}
+	if c := codigoCorANSI(fundo, 40); c != "" {
+		codigos = append(codigos, c)
+	}
+	return "\x1b[" + strings.Join(codigos, ";") + "m"
+}
+
+// codigoCorANSI retorna o código SGR da cor básica a partir da base
+// (30 para o texto, 40 para o fundo); "" para a cor padrão
+func codigoCorANSI(cor Cor, base int) string {
+	basica := cor & mascaraCorBasica
+	switch {
+	case basica == CorPadrao:
+		return ""
+	case basica <= CorBranco:
+		return strconv.Itoa(base + int(basica-CorPreto))
+	case basica <= CorCinzaClaro:
+		// Cores claras: versões "brilhantes" (90-97 e 100-107)
+		return strconv.Itoa(base + 60 + int(basica-CorCinzaEscuro))
+	}
+	return ""
+}
+
+// novaGrade cria uma grade de células vazias
+func novaGrade(largura, altura int) [][]Celula {
+	grade := make([][]Celula, altura)
+	for y := range grade {
+		grade[y] = make([]Celula, largura)
+		for x := range grade[y] {
+			grade[y][x] = Celula{Ch: ' '}
+		}
+	}
+	return grade
+}
@@ -0,0 +1,138 @@
+// renderizador_memoria.go - Renderizador em memória, sem terminal
+// Guarda as células em uma grade e, a cada Atualizar, registra o quadro como
+// texto. A entrada é fornecida pelo próprio programa com Enviar. Serve para
+// testar a interface sem um terminal real e como base para outras interfaces.
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// Celula é o conteúdo de uma posição da tela
+type Celula struct {
+	Ch    rune
+	Cor   Cor
+	Fundo Cor
+}
+
+// RenderizadorMemoria implementa Renderizador guardando tudo em memória
+type RenderizadorMemoria struct {
+	mutex   sync.Mutex
+	largura int
+	altura  int
+	buffer  [][]Celula
+	quadros []string // texto de cada quadro exibido com Atualizar
+	eventos chan EventoEntrada
+}
+
+// NovoRenderizadorMemoria cria uma tela em memória com o tamanho informado
+func NovoRenderizadorMemoria(largura, altura int) *RenderizadorMemoria {
+	r := &RenderizadorMemoria{
+		largura: largura,
+		altura:  altura,
+		eventos: make(chan EventoEntrada, 64),
+	}
+	r.Limpar()
+	return r
+}
+
+func (r *RenderizadorMemoria) Iniciar() error {
+	return nil
+}
+
+func (r *RenderizadorMemoria) Finalizar() {}
+
+func (r *RenderizadorMemoria) Tamanho() (int, int) {
+	return r.largura, r.altura
+}
+
+func (r *RenderizadorMemoria) Limpar() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.buffer = novaGrade(r.largura, r.altura)
+}
+
+func (r *RenderizadorMemoria) DefinirCelula(x, y int, ch rune, cor, fundo Cor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Como no termbox, células fora da tela são ignoradas
+	if y < 0 || y >= r.altura || x < 0 || x >= r.largura {
+		return
+	}
+	r.buffer[y][x] = Celula{Ch: ch, Cor: cor, Fundo: fundo}
+}
+
+func (r *RenderizadorMemoria) Atualizar() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.quadros = append(r.quadros, r.texto())
+	return nil
+}
+
+func (r *RenderizadorMemoria) LerEvento() EventoEntrada {
+	return <-r.eventos
+}
+
+func (r *RenderizadorMemoria) Interromper() {
+	// Como no renderizador ANSI: com a fila cheia já há eventos pendentes e a
+	// leitura retornará, e quem interrompe (a atualização do estado, a
+	// predição) não pode ficar bloqueado
+	select {
+	case r.eventos <- EventoEntrada{Tipo: EntradaInterrupcao}:
+	default:
+	}
+}
+
+// Enviar fornece um evento de entrada para a próxima chamada de LerEvento
+func (r *RenderizadorMemoria) Enviar(ev EventoEntrada) {
+	r.eventos <- ev
+}
+
+// Celula retorna o conteúdo atual do buffer na posição (x, y)
+func (r *RenderizadorMemoria) Celula(x, y int) Celula {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if y < 0 || y >= r.altura || x < 0 || x >= r.largura {
+		return Celula{}
+	}
+	return r.buffer[y][x]
+}
+
+// Quadros retorna o texto de todos os quadros exibidos até agora
+func (r *RenderizadorMemoria) Quadros() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string(nil), r.quadros...)
+}
+
+// UltimoQuadro retorna o texto do último quadro exibido ("" se nenhum)
+func (r *RenderizadorMemoria) UltimoQuadro() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.quadros) == 0 {
+		return ""
+	}
+	return r.quadros[len(r.quadros)-1]
+}
+
+// texto converte o buffer em linhas de texto, sem espaços à direita.
+// Deve ser chamada com o mutex travado.
+func (r *RenderizadorMemoria) texto() string {
+	var sb strings.Builder
+	for _, linha := range r.buffer {
+		runas := make([]rune, len(linha))
+		for x, c := range linha {
+			runas[x] = c.Ch
+		}
+		sb.WriteString(strings.TrimRight(string(runas), " "))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
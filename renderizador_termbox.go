@@ -0,0 +1,96 @@
+// renderizador_termbox.go - Renderizador que usa a biblioteca termbox-go
+package main
+
+import "github.com/nsf/termbox-go"
+
+// RenderizadorTermbox desenha no terminal usando termbox
+type RenderizadorTermbox struct{}
+
+// NovoRenderizadorTermbox cria o renderizador termbox
+func NovoRenderizadorTermbox() *RenderizadorTermbox {
+	return &RenderizadorTermbox{}
+}
+
+// Converte uma Cor do jogo para o atributo equivalente do termbox
+func corTermbox(cor Cor) termbox.Attribute {
+	// As cores básicas seguem a mesma ordem das constantes do termbox
+	attr := termbox.Attribute(cor & mascaraCorBasica)
+	atributos := []struct {
+		cor  Cor
+		attr termbox.Attribute
+	}{
+		{AtributoNegrito, termbox.AttrBold},
+		{AtributoPiscante, termbox.AttrBlink},
+		{AtributoOculto, termbox.AttrHidden},
+		{AtributoTenue, termbox.AttrDim},
+		{AtributoSublinhado, termbox.AttrUnderline},
+		{AtributoItalico, termbox.AttrCursive},
+		{AtributoInverso, termbox.AttrReverse},
+	}
+	for _, a := range atributos {
+		if cor&a.cor != 0 {
+			attr |= a.attr
+		}
+	}
+	return attr
+}
+
+// Teclas especiais do termbox e seus equivalentes
+var teclasTermbox = map[termbox.Key]Tecla{
+	termbox.KeyEsc:        TeclaEsc,
+	termbox.KeyEnter:      TeclaEnter,
+	termbox.KeyBackspace:  TeclaBackspace,
+	termbox.KeyBackspace2: TeclaBackspace,
+	termbox.KeyTab:        TeclaTab,
+	termbox.KeySpace:      TeclaEspaco,
+	termbox.KeyArrowUp:    TeclaSetaCima,
+	termbox.KeyArrowDown:  TeclaSetaBaixo,
+	termbox.KeyArrowLeft:  TeclaSetaEsquerda,
+	termbox.KeyArrowRight: TeclaSetaDireita,
+}
+
+func (r *RenderizadorTermbox) Iniciar() error {
+	return termbox.Init()
+}
+
+func (r *RenderizadorTermbox) Finalizar() {
+	termbox.Close()
+}
+
+func (r *RenderizadorTermbox) Tamanho() (int, int) {
+	return termbox.Size()
+}
+
+func (r *RenderizadorTermbox) Limpar() {
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+}
+
+func (r *RenderizadorTermbox) DefinirCelula(x, y int, ch rune, cor, fundo Cor) {
+	termbox.SetCell(x, y, ch, corTermbox(cor), corTermbox(fundo))
+}
+
+func (r *RenderizadorTermbox) Atualizar() error {
+	return termbox.Flush()
+}
+
+func (r *RenderizadorTermbox) LerEvento() EventoEntrada {
+	ev := termbox.PollEvent()
+	switch ev.Type {
+	case termbox.EventInterrupt:
+		return EventoEntrada{Tipo: EntradaInterrupcao}
+	case termbox.EventResize:
+		return EventoEntrada{Tipo: EntradaRedimensionar}
+	case termbox.EventKey:
+		if ev.Ch != 0 {
+			return EventoEntrada{Tipo: EntradaTecla, Ch: ev.Ch}
+		}
+		if tecla, existe := teclasTermbox[ev.Key]; existe {
+			return EventoEntrada{Tipo: EntradaTecla, Tecla: tecla}
+		}
+	}
+	return EventoEntrada{Tipo: EntradaNenhuma}
+}
+
+func (r *RenderizadorTermbox) Interromper() {
+	termbox.Interrupt()
+}
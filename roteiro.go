@@ -0,0 +1,339 @@
+// roteiro.go - Cliente sem interface dirigido por roteiro
+// O modo "roteiro" lê comandos da entrada padrão ou de um arquivo, um por linha,
+// e os executa com a mesma API ClienteJogo usada pelo cliente termbox. Cada
+// mudança de estado observada é impressa como uma linha JSON, o que permite
+// usar o modo como driver de testes de integração.
+//
+// Comandos:
+//
+//	mover <direção>     move o personagem (cima, baixo, esquerda, direita
+//	                    ou w, a, s, d)
+//	interagir           interage na posição atual
+//	chat <texto>        envia uma mensagem de chat
+//	esperar <duração>   pausa o roteiro (ex. 500ms, 2s)
+//	assert pos <x> <y>  falha se o personagem não estiver em (x, y)
+//	assert jogadores <n> falha se não houver n jogadores no jogo
+//	assert visiveis <n> falha se não houver n jogadores na área de interesse
+//	                    (contando o próprio personagem)
+//	sair                encerra o roteiro
+//
+// Linhas vazias e iniciadas por # são ignoradas. Uma asserção que falha
+// encerra o roteiro com código de saída 1.
+//
+// O estado só traz os jogadores da área de interesse (ver interesse.go), então
+// um jogador que aparece ou some do estado gera "jogador_visivel" ou
+// "jogador_fora_de_vista", quer tenha entrado ou saído do jogo, quer tenha
+// cruzado a borda da área. Entradas e saídas do jogo aparecem no evento
+// "jogadores", com o total de jogadores no jogo, e nas mensagens.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errAssercao indica que uma asserção do roteiro falhou
+var errAssercao = errors.New("asserção falhou")
+
+// observadorEstado compara estados sucessivos e imprime as diferenças em JSON
+type observadorEstado struct {
+	mutex    sync.Mutex
+	saida    *json.Encoder
+	inicio   time.Time
+	eu       int
+	anterior EstadoJogo
+}
+
+// emitir imprime uma linha JSON com o evento e seus campos
+func (o *observadorEstado) emitir(evento string, campos map[string]interface{}) {
+	linha := map[string]interface{}{
+		"evento": evento,
+		"ms":     time.Since(o.inicio).Milliseconds(),
+	}
+	for chave, valor := range campos {
+		linha[chave] = valor
+	}
+	o.saida.Encode(linha)
+}
+
+// evento imprime uma linha JSON de forma segura entre goroutines
+func (o *observadorEstado) evento(evento string, campos map[string]interface{}) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.emitir(evento, campos)
+}
+
+// atualizar imprime o que mudou desde o último estado observado.
+// Estados mais antigos que o último (chegados fora de ordem) são ignorados.
+func (o *observadorEstado) atualizar(estado EstadoJogo) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if estado.Versao <= o.anterior.Versao && o.anterior.Jogadores != nil {
+		return
+	}
+
+	for id, j := range estado.Jogadores {
+		antes, existia := o.anterior.Jogadores[id]
+		switch {
+		case !existia:
+			o.emitir("jogador_visivel", map[string]interface{}{"jogador": id, "nome": j.Nome, "x": j.PosX, "y": j.PosY})
+		case antes.PosX != j.PosX || antes.PosY != j.PosY:
+			evento := "jogador_moveu"
+			if id == o.eu {
+				evento = "movido"
+			}
+			o.emitir(evento, map[string]interface{}{"jogador": id, "x": j.PosX, "y": j.PosY})
+		}
+	}
+	for id, j := range o.anterior.Jogadores {
+		if _, existe := estado.Jogadores[id]; !existe {
+			o.emitir("jogador_fora_de_vista", map[string]interface{}{"jogador": id, "nome": j.Nome})
+		}
+	}
+	if estado.TotalJogadores != o.anterior.TotalJogadores {
+		o.emitir("jogadores", map[string]interface{}{"total": estado.TotalJogadores})
+	}
+
+	// As mensagens só crescem; as novas são as que passam do tamanho anterior
+	if len(estado.Mensagens) > len(o.anterior.Mensagens) {
+		for _, texto := range estado.Mensagens[len(o.anterior.Mensagens):] {
+			o.emitir("mensagem", map[string]interface{}{"texto": texto})
+		}
+	}
+
+	if estado.Encerrando && estado.SegundosParaEncerrar != o.anterior.SegundosParaEncerrar {
+		o.emitir("encerrando", map[string]interface{}{"segundos": estado.SegundosParaEncerrar})
+	}
+
+	o.anterior = estado
+}
+
+// ExecutarRoteiro interpreta os argumentos do modo "roteiro" e executa os comandos
+func ExecutarRoteiro(args []string) error {
+	fs := flag.NewFlagSet("roteiro", flag.ExitOnError)
+	endereco := fs.String("endereco", "localhost:8080", "Endereço do servidor")
+	nome := fs.String("nome", "Roteiro", "Nome do jogador")
+	simbolo := fs.String("simbolo", "☺", "Símbolo do jogador")
+	cor := fs.String("cor", "padrao", "Cor do jogador (ex. verde, azul_claro)")
+	senha := fs.String("senha", "", "Senha da conta do jogador")
+	intervalo := fs.Duration("intervalo", 100*time.Millisecond, "Intervalo de atualização do estado")
+	falhas := registrarFlagsFalhas(fs)
+	fs.DurationVar(&tempoLimiteChamada, "tempo-limite", tempoLimiteChamada, "Tempo máximo de espera por cada resposta do servidor (0 espera para sempre)")
+	fs.Parse(args)
+	falhasCliente = *falhas
+
+	// Roteiro do arquivo informado ou da entrada padrão
+	var entrada io.Reader = os.Stdin
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		arq, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer arq.Close()
+		entrada = arq
+	}
+
+	simboloRune, err := simboloDeTexto(*simbolo)
+	if err != nil {
+		return err
+	}
+
+	corJogador, ok := corPorNome(*cor)
+	if !ok {
+		return fmt.Errorf("cor desconhecida: %q", *cor)
+	}
+
+	// Sem um jogador para perguntar, aceitar a sugestão do servidor se a
+	// aparência pedida já estiver em uso
+	cliente, err := entrarComSugestao(func(a Aparencia) (*ClienteJogo, error) {
+		return NovoCliente(*endereco, EntrarArgs{Nome: *nome, Simbolo: a.Simbolo, Cor: a.Cor, Senha: *senha})
+	}, Aparencia{simboloRune, corJogador})
+	if err != nil {
+		return err
+	}
+	defer cliente.Sair()
+
+	o := &observadorEstado{
+		saida:  json.NewEncoder(os.Stdout),
+		inicio: time.Now(),
+		eu:     cliente.ID,
+	}
+	o.evento("conectado", map[string]interface{}{
+		"jogador": cliente.ID, "nome": cliente.Nome, "x": cliente.PosX, "y": cliente.PosY,
+		"simbolo": string(cliente.Simbolo), "cor": corNome(cliente.Cor),
+	})
+	o.atualizar(cliente.Estado())
+
+	cliente.IniciarAtualizacao(*intervalo, func() {
+		if cliente.ServidorEncerrado() {
+			o.evento("encerrado", nil)
+			return
+		}
+		o.atualizar(cliente.Estado())
+	})
+
+	return executarRoteiro(entrada, cliente, o)
+}
+
+// executarRoteiro executa os comandos lidos de entrada, um por linha
+func executarRoteiro(entrada io.Reader, cliente *ClienteJogo, o *observadorEstado) error {
+	scanner := bufio.NewScanner(entrada)
+	numero := 0
+	for scanner.Scan() {
+		numero++
+		linha := strings.TrimSpace(scanner.Text())
+		if linha == "" || strings.HasPrefix(linha, "#") {
+			continue
+		}
+		campos := strings.Fields(linha)
+
+		if cliente.ServidorEncerrado() {
+			return fmt.Errorf("linha %d: %s", numero, MensagemServidorEncerrado)
+		}
+
+		var err error
+		var bloqueadoPor string
+		switch campos[0] {
+		case "mover":
+			direcao := DirecaoNenhuma
+			if len(campos) == 2 {
+				direcao = direcaoDoRoteiro(campos[1])
+			}
+			if direcao == DirecaoNenhuma {
+				return fmt.Errorf("linha %d: uso: mover cima|baixo|esquerda|direita (ou w|a|s|d)", numero)
+			}
+			var resposta EnviarComandoReply
+			resposta, err = cliente.EnviarComando(NovoComandoMover(direcao))
+			bloqueadoPor = resposta.BloqueadoPor
+
+		case "interagir":
+			_, err = cliente.EnviarComando(NovoComandoInteragir())
+
+		case "chat":
+			texto := strings.TrimSpace(strings.TrimPrefix(linha, "chat"))
+			err = cliente.EnviarMensagem(texto)
+
+		case "esperar":
+			if len(campos) != 2 {
+				return fmt.Errorf("linha %d: uso: esperar <duração>", numero)
+			}
+			duracao, errDuracao := time.ParseDuration(campos[1])
+			if errDuracao != nil {
+				return fmt.Errorf("linha %d: %v", numero, errDuracao)
+			}
+			time.Sleep(duracao)
+			continue
+
+		case "assert":
+			if err := verificarAssercao(numero, campos[1:], cliente, o); err != nil {
+				return err
+			}
+			continue
+
+		case "sair":
+			return nil
+
+		default:
+			return fmt.Errorf("linha %d: comando desconhecido %q", numero, campos[0])
+		}
+
+		resultado := map[string]interface{}{"linha": numero, "comando": linha, "ok": err == nil}
+		if err != nil {
+			resultado["erro"] = err.Error()
+			var erroChamada *ErroChamada
+			if errors.As(err, &erroChamada) {
+				resultado["falha"] = erroChamada.Tipo.String()
+			}
+		}
+		if bloqueadoPor != "" {
+			resultado["bloqueado_por"] = bloqueadoPor
+		}
+		o.evento("comando", resultado)
+
+		// Buscar o estado logo após o comando para que seu efeito apareça na saída
+		if estado, err := cliente.ObterEstado(); err == nil {
+			o.atualizar(estado)
+		}
+	}
+	return scanner.Err()
+}
+
+// direcaoDoRoteiro interpreta a direção de um comando mover, pelo nome ou pela
+// tecla w, a, s ou d (DirecaoNenhuma se não for válida)
+func direcaoDoRoteiro(texto string) Direcao {
+	if d, ok := direcaoPorNome(texto); ok {
+		return d
+	}
+	if r := []rune(texto); len(r) == 1 {
+		return direcaoDeTecla(r[0])
+	}
+	return DirecaoNenhuma
+}
+
+// verificarAssercao avalia "assert pos x y", "assert jogadores n" e
+// "assert visiveis n" contra o estado atual
+func verificarAssercao(numero int, args []string, cliente *ClienteJogo, o *observadorEstado) error {
+	uso := fmt.Errorf("linha %d: uso: assert pos <x> <y> | assert jogadores <n> | assert visiveis <n>", numero)
+	if len(args) == 0 {
+		return uso
+	}
+
+	estado, err := cliente.ObterEstado()
+	if err != nil {
+		return fmt.Errorf("linha %d: %v", numero, err)
+	}
+	o.atualizar(estado)
+
+	var esperado, obtido string
+	switch args[0] {
+	case "pos":
+		if len(args) != 3 {
+			return uso
+		}
+		x, errX := strconv.Atoi(args[1])
+		y, errY := strconv.Atoi(args[2])
+		if errX != nil || errY != nil {
+			return uso
+		}
+		jogador := estado.Jogadores[cliente.ID]
+		esperado = fmt.Sprintf("%d %d", x, y)
+		obtido = fmt.Sprintf("%d %d", jogador.PosX, jogador.PosY)
+
+	case "jogadores", "visiveis":
+		if len(args) != 2 {
+			return uso
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return uso
+		}
+		esperado = strconv.Itoa(n)
+		obtido = strconv.Itoa(estado.TotalJogadores)
+		if args[0] == "visiveis" {
+			obtido = strconv.Itoa(len(estado.Jogadores))
+		}
+
+	default:
+		return uso
+	}
+
+	ok := esperado == obtido
+	o.evento("assert", map[string]interface{}{
+		"linha": numero, "assert": strings.Join(args, " "), "ok": ok, "esperado": esperado, "obtido": obtido,
+	})
+	if !ok {
+		return errAssercao
+	}
+	return nil
+}
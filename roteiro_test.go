@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roteiroTeste conecta um cliente em memória a um servidor novo e executa o
+// roteiro, retornando os eventos impressos e o erro do roteiro
+func roteiroTeste(t *testing.T, roteiro string) ([]map[string]interface{}, error) {
+	t.Helper()
+	servidor, err := NovoServidor("mapa.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cliente, err := NovoClienteLocal(servidor, EntrarArgs{Nome: "Roteiro", Simbolo: 'R'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cliente.Sair()
+
+	var saida bytes.Buffer
+	o := &observadorEstado{saida: json.NewEncoder(&saida), inicio: time.Now(), eu: cliente.ID}
+	o.atualizar(cliente.Estado())
+	errRoteiro := executarRoteiro(strings.NewReader(roteiro), cliente, o)
+
+	var eventos []map[string]interface{}
+	dec := json.NewDecoder(&saida)
+	for dec.More() {
+		var ev map[string]interface{}
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		eventos = append(eventos, ev)
+	}
+	return eventos, errRoteiro
+}
+
+func TestRoteiroAssercoes(t *testing.T) {
+	eventos, err := roteiroTeste(t, `
+# o jogador entra em (1, 1), com parede acima
+mover direita
+assert pos 2 1
+mover cima
+assert pos 2 1
+chat olá
+assert jogadores 1
+assert visiveis 1
+sair
+mover direita
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var asserts, bloqueados, mensagens int
+	for _, ev := range eventos {
+		switch ev["evento"] {
+		case "assert":
+			asserts++
+			if ev["ok"] != true {
+				t.Errorf("asserção falhou: %v", ev)
+			}
+		case "comando":
+			if ev["bloqueado_por"] == ObstaculoParede {
+				bloqueados++
+			}
+		case "mensagem":
+			if strings.Contains(ev["texto"].(string), "olá") {
+				mensagens++
+			}
+		}
+	}
+	if asserts != 4 || bloqueados != 1 || mensagens != 1 {
+		t.Fatalf("asserções %d, bloqueios %d, mensagens %d; eventos: %v", asserts, bloqueados, mensagens, eventos)
+	}
+}
+
+func TestRoteiroAssercaoFalha(t *testing.T) {
+	eventos, err := roteiroTeste(t, "assert pos 9 9\nmover direita\n")
+	if err != errAssercao {
+		t.Fatalf("erro %v, esperado %v", err, errAssercao)
+	}
+	ultimo := eventos[len(eventos)-1]
+	if ultimo["evento"] != "assert" || ultimo["obtido"] != "1 1" {
+		t.Fatalf("último evento %v", ultimo)
+	}
+}
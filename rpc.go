@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 // Estruturas para RPC (Remote Procedure Call)
 
 // Args para requisição de um jogador se conectar ao jogo
@@ -7,37 +9,84 @@ type EntrarArgs struct {
 	Nome    string
 	Simbolo rune
 	Cor     Cor
+	Senha   string // Senha da conta com este nome (vazia para visitantes)
 }
 
 // Resposta do servidor para um jogador que deseja se conectar
 type EntrarReply struct {
 	JogadorID int
+	Nome      string // Nome com que o jogador entrou (pode ter recebido um sufixo)
+	Sessao    string // Chave da sessão, exigida nas chamadas seguintes (veja sessoes.go)
 	Sucesso   bool
 	Mensagem  string
 	Estado    EstadoJogo
+
+	// Preenchidos quando o símbolo ou a cor pedidos são recusados
+	AparenciaRecusada bool
+	Sugestoes         []Aparencia // combinações livres de símbolo e cor
+}
+
+// Args para criar uma conta de jogador
+type RegistrarArgs struct {
+	Nome  string
+	Senha string
+}
+
+// Resposta do servidor para a criação de uma conta
+type RegistrarReply struct {
+	Nome     string // Nome da conta, já limpo pelo servidor
+	Sucesso  bool
+	Mensagem string
 }
 
 // Args para enviar um comando ao servidor
 type EnviarComandoArgs struct {
 	JogadorID int
-	Tipo      string // "mover" ou "interagir"
-	Tecla     rune   // Para comandos de movimento
+	Sessao    string  `json:"-"` // Chave recebida em Entrar (fora do registro de eventos)
+	Comando   Comando // Ação e seus dados (veja comandos.go)
+	Sequencia uint64  // Número do comando, crescente para cada jogador (0 = sem número)
 }
 
 // Resposta do servidor para um comando enviado
 type EnviarComandoReply struct {
 	Sucesso  bool
 	Mensagem string
+
+	// Resultado do comando, para o cliente se atualizar sem esperar o próximo estado
+	PosX, PosY   int    // posição do jogador após o comando
+	Bloqueado    bool   // o movimento não aconteceu
+	BloqueadoPor string // "parede", "inimigo", "jogador", "limite" ou "obstaculo"
+	Versao       uint64 // versão do estado após o comando
+	Sequencia    uint64 // último comando numerado aceito do jogador
 }
 
 // Args para obter o estado atual do jogo
 type ObterEstadoArgs struct {
 	JogadorID int
+	Sessao    string // Chave recebida em Entrar
 }
 
 // Resposta do servidor com o estado atual do jogo
 type ObterEstadoReply struct {
-	Estado   EstadoJogo
+	Estado   EstadoJogo // só com os jogadores da área de interesse (veja interesse.go)
+	Sucesso  bool
+	Mensagem string
+
+	// Jogadores que entraram e que saíram da área de interesse desde a
+	// consulta anterior
+	Apareceram []int
+	Sumiram    []int
+}
+
+// Args para medir o tempo de ida e volta até o servidor
+type PingArgs struct {
+	JogadorID int
+	Sessao    string        `json:"-"` // Chave recebida em Entrar (fora do registro de eventos)
+	RTT       time.Duration // RTT médio medido pelo cliente até agora (zero se ainda não medido)
+}
+
+// Resposta do servidor para um ping
+type PingReply struct {
 	Sucesso  bool
 	Mensagem string
 }
@@ -45,6 +94,7 @@ type ObterEstadoReply struct {
 // Args para um jogador sair do jogo
 type SairArgs struct {
 	JogadorID int
+	Sessao    string // Chave recebida em Entrar
 }
 
 // Resposta do servidor para um jogador que deseja sair
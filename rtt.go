@@ -0,0 +1,140 @@
+// rtt.go - Medição do tempo de ida e volta (RTT) das chamadas
+// O cliente mede cada chamada ao servidor e mantém uma média móvel do RTT e
+// da sua variação (jitter), no estilo do TCP (RFC 6298). Como um jogador
+// parado não faz chamadas de comando, uma chamada Ping periódica mantém a
+// medida atualizada e informa ao servidor o RTT do jogador, exibido na lista
+// de jogadores de todos.
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Intervalo entre as chamadas Ping do cliente
+const intervaloPing = time.Second
+
+// Limites da qualidade da conexão mostrada na interface
+const (
+	latenciaBoa  = 100 * time.Millisecond // até aqui, verde
+	latenciaRuim = 300 * time.Millisecond // a partir daqui, vermelho
+)
+
+// medidorLatencia acumula as medidas de RTT de uma conexão
+type medidorLatencia struct {
+	mutex    sync.Mutex
+	ultimo   time.Duration // última medida
+	media    time.Duration // média móvel exponencial
+	variacao time.Duration // média móvel do desvio em relação à média (jitter)
+	medidas  int
+}
+
+// observar acrescenta uma medida de RTT
+func (m *medidorLatencia) observar(rtt time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.ultimo = rtt
+	if m.medidas == 0 {
+		m.media, m.variacao = rtt, rtt/2
+	} else {
+		desvio := m.media - rtt
+		if desvio < 0 {
+			desvio = -desvio
+		}
+		m.variacao += (desvio - m.variacao) / 4
+		m.media += (rtt - m.media) / 8
+	}
+	m.medidas++
+}
+
+// Latencia resume as medidas de RTT de um cliente
+type Latencia struct {
+	Ultima   time.Duration
+	Media    time.Duration
+	Variacao time.Duration // jitter
+	Medidas  int           // zero enquanto nenhuma chamada terminou
+}
+
+// resumo retorna as medidas acumuladas
+func (m *medidorLatencia) resumo() Latencia {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return Latencia{Ultima: m.ultimo, Media: m.media, Variacao: m.variacao, Medidas: m.medidas}
+}
+
+// Latencia retorna o RTT medido nas chamadas do cliente ao servidor
+func (c *ClienteJogo) Latencia() Latencia {
+	conexao := c.conexao
+	if conexao == nil {
+		return Latencia{}
+	}
+	return conexao.latencia.resumo()
+}
+
+// pingarPeriodicamente chama Ping a cada intervaloPing, informando o RTT
+// médio medido até então, e chama aoMudar com a nova medida
+func (c *ClienteJogo) pingarPeriodicamente(aoMudar func()) {
+	conexao := c.conexao
+	if conexao == nil {
+		return
+	}
+	ticker := time.NewTicker(intervaloPing)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-conexao.contexto.Done():
+			return
+		case <-ticker.C:
+		}
+
+		args := PingArgs{JogadorID: c.ID, Sessao: c.sessao, RTT: conexao.latencia.resumo().Media}
+		reply := PingReply{}
+		if err := conexao.chamar("ServidorJogo.Ping", &args, &reply); err != nil {
+			if erroDeEncerramento(err) {
+				return
+			}
+			continue
+		}
+		if aoMudar != nil {
+			aoMudar()
+		}
+	}
+}
+
+// Ping responde imediatamente, para o cliente medir o tempo de ida e volta,
+// e guarda o RTT informado pelo jogador para a lista de jogadores. O RTT é
+// telemetria, não estado do jogo: não muda a versão do estado (chega aos
+// clientes na próxima consulta) e não vai para o registro de eventos.
+func (s *ServidorJogo) Ping(args *PingArgs, reply *PingReply) error {
+	fim, ok := s.iniciarChamada("Ping")
+	if !ok {
+		return errServidorEncerrado
+	}
+	defer fim()
+
+	// Como os movimentos, o Ping não trava o servidor (ver regioes.go)
+	j, existe := s.jogadorPorID(args.JogadorID)
+	if existe && !sessaoConfere(j, args.Sessao) {
+		existe = false
+	}
+	if existe {
+		destravar := s.travarJogador(j)
+		if !j.removido && args.RTT > 0 {
+			j.info.RTT = args.RTT
+		}
+		existe = !j.removido
+		destravar()
+	}
+	if !existe {
+		s.travarLeitura()
+		reply.Sucesso = false
+		reply.Mensagem = s.jogadorAusente(args.JogadorID)
+		s.mutex.RUnlock()
+		return nil
+	}
+	reply.Sucesso = true
+	return nil
+}
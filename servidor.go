@@ -5,53 +5,196 @@ import (
 	"log"
 	"net"
 	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// Tamanho máximo, em caracteres, de uma mensagem de chat
+const tamanhoMaximoChat = 200
+
 // ServidorJogo implementa o servidor RPC do jogo
 type ServidorJogo struct {
-	estado    EstadoJogo
-	mutex     sync.RWMutex
+	// Contadores de acesso atômico, no início da estrutura para ficarem
+	// alinhados em 64 bits
+	versao uint64 // versão do estado (ver notificar)
+	tick   uint64 // número de eventos aceitos até agora (ver registrar)
+
+	estado    EstadoJogo               // mapa e mensagens; os jogadores ficam em jogadores
+	jogadores map[int]*jogadorServidor // jogadores em jogo, muda com mutex travado para escrita (ver regioes.go)
+	ocupacao  *gradeOcupacao           // jogador de cada célula, atualizada junto com os jogadores
+	mutex     sync.RWMutex             // para escrita em entradas, saídas e mensagens; para leitura nas consultas
 	nextID    int
+	mapaFile  string              // arquivo de onde o mapa foi carregado
+	registro  *RegistroEventos    // registro de eventos (nil se desativado)
+	contas    *Contas             // contas de jogadores (nil se desativado)
+	sessoes   map[int]sessaoConta // jogadores em jogo que entraram com conta
+	metricas  *MetricasServidor
+
+	// Limites de comandos por jogador (ver limites.go)
+	limites  ConfigLimites
+	expulsos map[int]string // motivo da expulsão de cada jogador expulso
+
+	// Regiões do mapa, com travas próprias para os movimentos (ver regioes.go)
+	regioes        []regiao
+	tamanhoRegiao  int // lado de cada região, em células
+	colunasRegioes int // regiões em cada faixa horizontal do mapa
+
+	// Cópia de jogadores publicada a cada entrada e saída, lida sem travas
+	// pelos movimentos (ver jogadorPorID)
+	indiceJogadores atomic.Value
+
+	raioInteresse int // raio da área de interesse de cada jogador (0 envia todos; ver interesse.go)
+
+	mutexAvisos   sync.Mutex // assinantes (ver notificar)
+	numAssinantes int32      // quantidade de assinantes (acesso atômico)
+	avisando      int32      // 1 enquanto alguém avisa os assinantes (acesso atômico)
+
+	// Controle de encerramento (ver encerramento.go)
+	controle    sync.Mutex
+	semChamadas *sync.Cond            // sinalizada quando emAndamento chega a zero
+	emAndamento int                   // chamadas RPC em execução
+	encerrado   bool                  // novas chamadas são recusadas
+	conexoes    map[net.Conn]struct{} // conexões abertas
+
+	// Assinantes avisados a cada mudança de estado (ver web.go)
+	assinantes map[chan struct{}]struct{}
+}
+
+// OpcoesServidor reúne as configurações de inicialização do servidor
+type OpcoesServidor struct {
+	Porta          string
+	Mapa           string
+	ArquivoEventos string        // arquivo do registro de eventos (vazio desativa)
+	Snapshot       string        // arquivo do snapshot final (vazio desativa)
+	Contagem       time.Duration // aviso dado aos jogadores antes de encerrar
+	PortaJSON      string        // porta do endpoint JSON-RPC (vazio desativa)
+	EnderecoHTTP   string        // endereço da API HTTP e do espectador web (vazio desativa)
+	ArquivoContas  string        // arquivo das contas de jogadores (vazio desativa as contas)
+	Falhas         ConfigFalhas  // falhas de rede simuladas nas conexões aceitas (veja falhas.go)
+	Limites        ConfigLimites // limites de comandos por jogador (veja limites.go)
+	TamanhoRegiao  int           // lado das regiões do mapa com trava própria (0 usa uma região só; veja regioes.go)
+	RaioInteresse  int           // raio da área de interesse dos jogadores (0 envia todos; veja interesse.go)
 }
 
 // NovoServidor cria uma nova instância do servidor
 func NovoServidor(mapaFile string) (*ServidorJogo, error) {
-	servidor := &ServidorJogo{
-		estado: EstadoJogo{
-			Jogadores: make(map[int]JogadorInfo),
-			Mensagens: []string{"Servidor iniciado. Bem-vindo!"},
-		},
-	}
-
 	// Carregar mapa
 	jogoTemp := jogoNovo()
 	if err := jogoCarregarMapa(mapaFile, &jogoTemp); err != nil {
 		return nil, err
 	}
 
-	servidor.estado.ElementosMapa = jogoTemp.Mapa
+	return novoServidorComMapa(mapaFile, jogoTemp.Mapa), nil
+}
+
+// novoServidorComMapa cria o servidor com um mapa já carregado (ou gerado,
+// como nos benchmarks)
+func novoServidorComMapa(mapaFile string, mapa [][]Elemento) *ServidorJogo {
+	servidor := &ServidorJogo{
+		estado: EstadoJogo{
+			Mensagens: []string{"Servidor iniciado. Bem-vindo!"},
+		},
+		jogadores:  make(map[int]*jogadorServidor),
+		mapaFile:   mapaFile,
+		sessoes:    make(map[int]sessaoConta),
+		metricas:   NovasMetricas(),
+		expulsos:   make(map[int]string),
+		conexoes:   make(map[net.Conn]struct{}),
+		assinantes: make(map[chan struct{}]struct{}),
+	}
+	servidor.semChamadas = sync.NewCond(&servidor.controle)
+	servidor.publicarJogadores()
+
+	servidor.estado.ElementosMapa = mapa
+	servidor.ocupacao = novaGradeOcupacao(mapa)
+	servidor.dividirRegioes(tamanhoRegiaoPadrao)
+	servidor.raioInteresse = raioInteressePadrao
 	
-	return servidor, nil
+	return servidor
 }
 
 // Entrar permite que um novo jogador entre no jogo
 func (s *ServidorJogo) Entrar(args *EntrarArgs, reply *EntrarReply) error {
-	s.mutex.Lock()
+	fim, ok := s.iniciarChamada("Entrar")
+	if !ok {
+		return errServidorEncerrado
+	}
+	defer fim()
+
+	// A senha de uma conta é conferida antes de travar o servidor, pois o
+	// hash é lento de propósito (ver contas.go)
+	autenticada, err := s.autenticarConta(args)
+	if err != nil {
+		reply.Sucesso = false
+		reply.Mensagem = err.Error()
+		return nil
+	}
+
+	// A chave da sessão é sorteada antes de travar o servidor
+	sessao, err := novaSessao()
+	if err != nil {
+		reply.Sucesso = false
+		reply.Mensagem = fmt.Sprintf("erro ao criar a sessão: %v", err)
+		return nil
+	}
+
+	s.travar()
 	defer s.mutex.Unlock()
 
-	// Gerar ID para o novo jogador
-	id := s.nextID
-	s.nextID++
+	// A entrada trava todas as regiões: a posição inicial depende de todo o
+	// mapa, e nenhum movimento pode acontecer entre a escolha da posição e o
+	// registro da entrada
+	s.travarTodasRegioes()
+	regioesTravadas := true
+	defer func() {
+		if regioesTravadas {
+			s.destravarTodasRegioes()
+		}
+	}()
+
+	// Validar o símbolo e a cor escolhidos
+	if !s.verificarAparencia(Aparencia{args.Simbolo, args.Cor}, reply) {
+		return nil
+	}
+
+	// Validar o nome; nomes repetidos recebem um sufixo e nomes de contas
+	// exigem a senha
+	nome, conta, err := s.escolherNome(args, autenticada)
+	if err != nil {
+		reply.Sucesso = false
+		reply.Mensagem = err.Error()
+		return nil
+	}
 
-	// Encontrar posição livre para o jogador
+	// Jogadores com conta voltam à última posição, se ela estiver livre;
+	// os demais vão para a primeira posição livre
+	var posicaoSalva *Posicao
 	posX, posY := s.encontrarPosicaoInicial()
+	if conta != nil {
+		if p, ok := s.posicaoDaConta(conta); ok {
+			posX, posY = p.X, p.Y
+			posicaoSalva = &p
+		}
+	}
 	if posX < 0 || posY < 0 {
 		reply.Sucesso = false
 		reply.Mensagem = "Não foi possível encontrar posição inicial"
 		return nil
 	}
 
+	// Gerar o ID só agora, para que entradas recusadas não gastem IDs (o
+	// replay, que só vê as entradas aceitas, precisa dos mesmos IDs)
+	id := s.nextID
+	s.nextID++
+	if conta != nil {
+		s.iniciarSessaoConta(id, conta)
+	}
+
 	// Criar jogador
 	jogador := JogadorInfo{
 		ID:      id,
@@ -59,153 +202,522 @@ func (s *ServidorJogo) Entrar(args *EntrarArgs, reply *EntrarReply) error {
 		PosY:    posY,
 		Simbolo: args.Simbolo,
 		Cor:     args.Cor,
-		Nome:    args.Nome,
+		Nome:    nome,
 	}
 
 	// Adicionar ao estado
-	s.estado.Jogadores[id] = jogador
-	s.estado.Mensagens = append(s.estado.Mensagens, fmt.Sprintf("Jogador %s entrou no jogo", args.Nome))
+	s.adicionarJogador(&jogadorServidor{info: jogador, sessao: sessao})
+	s.estado.Mensagens = append(s.estado.Mensagens, fmt.Sprintf("Jogador %s entrou no jogo", nome))
+	s.notificar()
+
+	// O registro guarda o nome final e nunca a senha; no replay não há
+	// contas, então a posição restaurada da conta também é registrada
+	registrado := *args
+	registrado.Nome = nome
+	registrado.Senha = ""
+	s.registrar(Evento{Tipo: EventoEntrar, JogadorID: id, Entrar: &registrado, Posicao: posicaoSalva})
+	s.destravarTodasRegioes()
+	regioesTravadas = false
 
 	// Preparar resposta
 	reply.JogadorID = id
+	reply.Nome = nome
+	reply.Sessao = sessao
 	reply.Sucesso = true
 	reply.Mensagem = "Bem-vindo ao jogo!"
-	reply.Estado = s.estado
+	reply.Estado, _, _ = s.estadoVisivel(id, sessao)
 
-	fmt.Printf("Jogador %s (ID: %d) entrou no jogo\n", args.Nome, id)
+	log.Printf("Jogador %s (ID: %d) entrou no jogo", nome, id)
 	return nil
 }
 
 // EnviarComando processa um comando de um jogador
 func (s *ServidorJogo) EnviarComando(args *EnviarComandoArgs, reply *EnviarComandoReply) error {
-	s.mutex.Lock()
+	fim, ok := s.iniciarChamada("EnviarComando")
+	if !ok {
+		return errServidorEncerrado
+	}
+	defer fim()
+
+	// Movimentos não travam o servidor, só o jogador e as regiões do mapa
+	// envolvidas, para rodarem em paralelo (ver regioes.go)
+	if args.Comando.Tipo == ComandoMover {
+		s.moverJogador(args, reply)
+		return nil
+	}
+
+	s.travar()
 	defer s.mutex.Unlock()
 
-	// Verificar se o jogador existe
-	jogador, existe := s.estado.Jogadores[args.JogadorID]
-	if !existe {
+	// Verificar se o jogador existe e se a chave é a dele
+	j, existe := s.jogadores[args.JogadorID]
+	if !existe || !sessaoConfere(j, args.Sessao) {
 		reply.Sucesso = false
-		reply.Mensagem = "Jogador não encontrado"
+		reply.Mensagem = s.jogadorAusente(args.JogadorID)
 		return nil
 	}
 
-	// Processar o comando
-	switch args.Tipo {
-	case "mover":
-		dx, dy := 0, 0
-		switch args.Tecla {
-		case 'w': dy = -1 // Move para cima
-		case 'a': dx = -1 // Move para a esquerda
-		case 's': dy = 1  // Move para baixo
-		case 'd': dx = 1  // Move para a direita
+	// O jogador fica travado até o registro, para que o comando fique no
+	// registro antes dos movimentos seguintes dele
+	destravar := s.travarJogador(j)
+	if aceito, expulsar := s.aceitarComando(j, args, reply); !aceito {
+		destravar()
+		if expulsar {
+			s.expulsar(j, motivoExcessoComandos)
 		}
+		return nil
+	}
+	defer destravar()
 
-		nx, ny := jogador.PosX+dx, jogador.PosY+dy
-		// Verificar se o movimento é permitido
-		if s.podeMoverPara(nx, ny) {
-			jogador.PosX, jogador.PosY = nx, ny
-			s.estado.Jogadores[args.JogadorID] = jogador
+	if args.Sequencia != 0 {
+		j.info.UltimaSequencia = args.Sequencia
+		reply.Sequencia = args.Sequencia
+	}
+	jogador := j.info
+	comando := &args.Comando
+
+	// Processar o comando
+	switch comando.Tipo {
+	case ComandoInteragir:
+		// As mensagens chegam a todos os jogadores, então não levam a
+		// posição, que só quem está na área de interesse pode ver
+		s.estado.Mensagens = append(s.estado.Mensagens,
+			fmt.Sprintf("%s está interagindo", jogador.Nome))
+		s.notificar()
+		if conta := s.contaDoJogador(args.JogadorID); conta != nil {
+			conta.Estatisticas.Interacoes++
 		}
 
-	case "interagir":
-		s.estado.Mensagens = append(s.estado.Mensagens, 
-			fmt.Sprintf("%s está interagindo em (%d, %d)", 
-				jogador.Nome, jogador.PosX, jogador.PosY))
+	case ComandoChat:
+		s.estado.Mensagens = append(s.estado.Mensagens, fmt.Sprintf("%s: %s", jogador.Nome, comando.Texto))
+		s.notificar()
+		if conta := s.contaDoJogador(args.JogadorID); conta != nil {
+			conta.Estatisticas.Mensagens++
+		}
 	}
 
+	s.registrar(Evento{Tipo: comando.Tipo.String(), JogadorID: args.JogadorID, Comando: args})
+	s.metricas.registrarComando()
+
 	reply.Sucesso = true
 	reply.Mensagem = "Comando processado com sucesso"
+	reply.PosX, reply.PosY = jogador.PosX, jogador.PosY
+	reply.Versao = s.versaoAtual()
 	return nil
 }
 
+// aceitarComando aplica ao comando os limites do jogador, a ordem das
+// sequências e a validação. Se o comando não deve ser executado, preenche a
+// recusa em reply e retorna false, e expulsar indica se o jogador deve ser
+// expulso. Deve ser chamada com o mutex do jogador travado (ou com o mutex
+// do servidor travado para escrita).
+func (s *ServidorJogo) aceitarComando(j *jogadorServidor, args *EnviarComandoArgs, reply *EnviarComandoReply) (aceito, expulsar bool) {
+	reply.Sequencia = j.info.UltimaSequencia
+
+	// Descartar comandos acima dos limites do jogador, antes de consumir a
+	// sequência, para que o próximo comando numerado ainda seja aceito
+	if recusa, expulsar := s.limitarComando(j, args.Comando.Tipo); recusa != "" {
+		reply.Sucesso = false
+		reply.Mensagem = recusa
+		return false, expulsar
+	}
+
+	// Comandos numerados devem chegar em ordem; repetidos ou atrasados são recusados
+	if args.Sequencia != 0 && args.Sequencia <= j.info.UltimaSequencia {
+		reply.Sucesso = false
+		reply.Mensagem = fmt.Sprintf("comando %d fora de ordem", args.Sequencia)
+		return false, false
+	}
+
+	// Validar o comando antes de executá-lo
+	if err := s.validarComando(&args.Comando, j.info); err != nil {
+		reply.Sucesso = false
+		reply.Mensagem = err.Error()
+		return false, false
+	}
+	return true, false
+}
+
 // ObterEstado retorna o estado atual do jogo
 func (s *ServidorJogo) ObterEstado(args *ObterEstadoArgs, reply *ObterEstadoReply) error {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	fim, ok := s.iniciarChamada("ObterEstado")
+	if !ok {
+		return errServidorEncerrado
+	}
+	defer fim()
+
+	// Só os jogadores da área de interesse do dono da sessão (ver interesse.go)
+	s.travarLeitura()
+	reply.Estado, reply.Apareceram, reply.Sumiram = s.estadoVisivel(args.JogadorID, args.Sessao)
+	s.mutex.RUnlock()
 
-	reply.Estado = s.estado
 	reply.Sucesso = true
 	return nil
 }
 
 // Sair remove um jogador do jogo
 func (s *ServidorJogo) Sair(args *SairArgs, reply *SairReply) error {
-	s.mutex.Lock()
+	fim, ok := s.iniciarChamada("Sair")
+	if !ok {
+		return errServidorEncerrado
+	}
+	defer fim()
+
+	s.travar()
 	defer s.mutex.Unlock()
 
-	jogador, existe := s.estado.Jogadores[args.JogadorID]
-	if !existe {
+	j, existe := s.jogadores[args.JogadorID]
+	if !existe || !sessaoConfere(j, args.Sessao) {
 		reply.Sucesso = false
-		reply.Mensagem = "Jogador não encontrado"
+		reply.Mensagem = s.jogadorAusente(args.JogadorID)
 		return nil
 	}
+	destravar := s.travarJogador(j)
+	defer destravar()
+	jogador := j.info
+
+	// Guardar o progresso da conta antes de remover o jogador
+	if s.encerrarSessaoConta(j) {
+		s.gravarContas()
+	}
 
 	// Remover jogador
-	delete(s.estado.Jogadores, args.JogadorID)
+	s.removerJogador(j)
 	s.estado.Mensagens = append(s.estado.Mensagens, fmt.Sprintf("Jogador %s saiu do jogo", jogador.Nome))
+	s.notificar()
+
+	s.registrar(Evento{Tipo: EventoSair, JogadorID: args.JogadorID})
 
 	reply.Sucesso = true
 	reply.Mensagem = "Você saiu do jogo"
 	
-	fmt.Printf("Jogador %s (ID: %d) saiu do jogo\n", jogador.Nome, jogador.ID)
+	log.Printf("Jogador %s (ID: %d) saiu do jogo", jogador.Nome, jogador.ID)
 	return nil
 }
 
 // Funções auxiliares
-func (s *ServidorJogo) encontrarPosicaoInicial() (int, int) {
-	// Procurar posição livre
-	for y := range s.estado.ElementosMapa {
-		for x := range s.estado.ElementosMapa[y] {
-			if s.podeMoverPara(x, y) {
-				return x, y
+
+// notificar incrementa a versão do estado e avisa os assinantes, se houver
+// algum. Deve ser chamada após cada mudança de estado, antes de destravar o
+// que protege a mudança. Só um chamador avisa os assinantes de cada vez; os
+// demais apenas incrementam a versão, e quem avisa confere no fim se ela
+// mudou e avisa de novo.
+func (s *ServidorJogo) notificar() {
+	atomic.AddUint64(&s.versao, 1)
+	if atomic.LoadInt32(&s.numAssinantes) == 0 {
+		return
+	}
+	for atomic.CompareAndSwapInt32(&s.avisando, 0, 1) {
+		versao := atomic.LoadUint64(&s.versao)
+		s.mutexAvisos.Lock()
+		for ch := range s.assinantes {
+			// Um aviso pendente já basta: o assinante lerá o estado mais recente
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		s.mutexAvisos.Unlock()
+		atomic.StoreInt32(&s.avisando, 0)
+
+		if atomic.LoadUint64(&s.versao) == versao {
+			return
+		}
+	}
+}
+
+// versaoAtual retorna a versão do estado
+func (s *ServidorJogo) versaoAtual() uint64 {
+	return atomic.LoadUint64(&s.versao)
+}
+
+// copiarEstado retorna uma cópia do estado que pode ser lida fora do mutex
+// (as respostas RPC são codificadas depois que o método retorna).
+// O mapa é compartilhado, pois não é alterado após o carregamento.
+// Deve ser chamada com o mutex do servidor travado, ao menos para leitura:
+// as regiões são todas travadas para que a cópia não pegue um movimento
+// pela metade. As consultas dos jogadores usam copiarArea, que trava só as
+// regiões da área de interesse.
+func (s *ServidorJogo) copiarEstado() EstadoJogo {
+	s.travarTodasRegioes()
+	estado := s.estado
+	estado.Jogadores = make(map[int]JogadorInfo, len(s.jogadores))
+	for id, j := range s.jogadores {
+		estado.Jogadores[id] = j.info
+	}
+	estado.Versao = s.versaoAtual()
+	estado.TotalJogadores = len(s.jogadores)
+	s.destravarTodasRegioes()
+
+	estado.Mensagens = append([]string(nil), s.estado.Mensagens...)
+	return estado
+}
+
+// copiarArea é como copiarEstado, mas copia só os jogadores a no máximo raio
+// células de (cx, cy) em cada eixo, travando só as regiões que cobrem essa
+// área
+func (s *ServidorJogo) copiarArea(cx, cy, raio int) EstadoJogo {
+	regioes := s.travarRegioesDoQuadrado(cx, cy, raio)
+	estado := s.estado
+	estado.Jogadores = make(map[int]JogadorInfo)
+	for _, r := range regioes {
+		for id, j := range s.regioes[r].jogadores {
+			if dentroDoRaio(raio, cx, cy, j.info.PosX, j.info.PosY) {
+				estado.Jogadores[id] = j.info
 			}
 		}
 	}
-	return -1, -1 // Não encontrou posição válida
+	estado.Versao = s.versaoAtual()
+	estado.TotalJogadores = len(s.jogadores)
+	s.destravarRegioesDoQuadrado(regioes)
+
+	estado.Mensagens = append([]string(nil), s.estado.Mensagens...)
+	return estado
+}
+
+func (s *ServidorJogo) encontrarPosicaoInicial() (int, int) {
+	// Procurar posição livre na grade de ocupação (ver ocupacao.go)
+	x, y, ok := s.ocupacao.primeiraLivre()
+	if !ok {
+		return -1, -1 // Não encontrou posição válida
+	}
+	return x, y
 }
 
 func (s *ServidorJogo) podeMoverPara(x, y int) bool {
+	return s.obstaculoEm(x, y) == ""
+}
+
+// Obstáculos que impedem um movimento, informados em EnviarComandoReply.BloqueadoPor
+const (
+	ObstaculoLimite   = "limite" // fora do mapa
+	ObstaculoParede   = "parede"
+	ObstaculoInimigo  = "inimigo"
+	ObstaculoJogador  = "jogador"
+	ObstaculoGenerico = "obstaculo" // outro elemento tangível do mapa
+)
+
+// obstaculoEm retorna o que impede um jogador de ocupar a posição, ou ""
+// se ela estiver livre. Os jogadores são consultados na grade de ocupação.
+func (s *ServidorJogo) obstaculoEm(x, y int) string {
+	if obstaculo := obstaculoNoMapa(s.estado.ElementosMapa, x, y); obstaculo != "" {
+		return obstaculo
+	}
+	if _, ocupada := s.ocupacao.ocupanteEm(x, y); ocupada {
+		return ObstaculoJogador
+	}
+	return ""
+}
+
+// obstaculoNoMapa retorna o elemento do mapa que impede ocupar a posição
+// (ou o limite do mapa), sem considerar os jogadores
+func obstaculoNoMapa(mapa [][]Elemento, x, y int) string {
 	// Verificar limites do mapa
-	if y < 0 || y >= len(s.estado.ElementosMapa) {
-		return false
+	if y < 0 || y >= len(mapa) {
+		return ObstaculoLimite
 	}
-	if x < 0 || x >= len(s.estado.ElementosMapa[y]) {
-		return false
+	if x < 0 || x >= len(mapa[y]) {
+		return ObstaculoLimite
 	}
 
 	// Verificar se o elemento é tangível
-	if s.estado.ElementosMapa[y][x].Tangivel {
-		return false
+	if elem := mapa[y][x]; elem.Tangivel {
+		switch elem.Simbolo {
+		case Parede.Simbolo:
+			return ObstaculoParede
+		case Inimigo.Simbolo:
+			return ObstaculoInimigo
+		}
+		return ObstaculoGenerico
+	}
+	return ""
+}
+
+// obstaculoNoEstado aplica as regras de colisão a um estado do jogo, como
+// obstaculoEm, percorrendo a lista de jogadores. É usada pela predição do
+// cliente (predicao.go), que não tem a grade de ocupação, para que o cliente
+// decida os movimentos da mesma forma que o servidor. O jogador ignorarID
+// (ou nenhum, se for -1) não conta como obstáculo.
+func obstaculoNoEstado(estado *EstadoJogo, x, y, ignorarID int) string {
+	if obstaculo := obstaculoNoMapa(estado.ElementosMapa, x, y); obstaculo != "" {
+		return obstaculo
 	}
 
 	// Verificar se há outro jogador na posição
-	for _, j := range s.estado.Jogadores {
-		if j.PosX == x && j.PosY == y {
-			return false
+	for _, j := range estado.Jogadores {
+		if j.ID != ignorarID && j.PosX == x && j.PosY == y {
+			return ObstaculoJogador
+		}
+	}
+
+	return ""
+}
+
+// prepararServidor cria o servidor e ativa os recursos opcionais das opções:
+// o registro de eventos e as contas de jogadores
+func prepararServidor(opcoes OpcoesServidor) (*ServidorJogo, error) {
+	servidor, err := NovoServidor(opcoes.Mapa)
+	if err != nil {
+		return nil, err
+	}
+	servidor.limites = opcoes.Limites
+	servidor.dividirRegioes(opcoes.TamanhoRegiao)
+	servidor.raioInteresse = opcoes.RaioInteresse
+
+	if opcoes.ArquivoContas != "" {
+		if servidor.contas, err = CarregarContas(opcoes.ArquivoContas); err != nil {
+			return nil, err
 		}
+		fmt.Println("Contas de jogadores em:", opcoes.ArquivoContas)
 	}
 
-	return true
+	// Ativar o registro de eventos por último, para não deixar o arquivo
+	// aberto se algo acima falhar
+	if opcoes.ArquivoEventos != "" {
+		if err := servidor.ativarRegistro(opcoes.ArquivoEventos); err != nil {
+			return nil, fmt.Errorf("erro ao abrir registro de eventos: %v", err)
+		}
+		fmt.Println("Registrando eventos em:", opcoes.ArquivoEventos)
+	}
+
+	return servidor, nil
 }
 
-// IniciarServidor inicia o servidor RPC
-func IniciarServidor(porta string, mapaFile string) {
-	servidor, err := NovoServidor(mapaFile)
+// IniciarServidor inicia o servidor RPC e o mantém em execução até receber
+// SIGINT ou SIGTERM, quando então realiza o encerramento gracioso
+func IniciarServidor(opcoes OpcoesServidor) {
+	servidor, err := prepararServidor(opcoes)
 	if err != nil {
 		log.Fatalf("Erro ao criar servidor: %v", err)
 	}
+	if servidor.registro != nil {
+		defer servidor.registro.Fechar()
+	}
 
+	// O primeiro sinal inicia o encerramento gracioso; um segundo sinal
+	// interrompe o processo imediatamente
+	sinais := make(chan os.Signal, 2)
+	signal.Notify(sinais, os.Interrupt, syscall.SIGTERM)
+	parar := make(chan struct{})
+	go func() {
+		<-sinais
+		close(parar)
+		<-sinais
+		log.Println("Segundo sinal recebido, encerrando imediatamente")
+		if servidor.registro != nil {
+			// Gravar os eventos que ainda estão na fila
+			servidor.registro.Fechar()
+		}
+		os.Exit(1)
+	}()
+
+	if err := servidor.servir(opcoes, parar, nil); err != nil {
+		log.Fatalf("Erro no servidor: %v", err)
+	}
+}
+
+// servir aceita conexões RPC na porta configurada até que parar seja fechado
+// e então encerra o servidor de forma graciosa. pronto (se não for nil) é
+// chamada quando todas as portas já estão abertas.
+func (s *ServidorJogo) servir(opcoes OpcoesServidor, parar <-chan struct{}, pronto func()) error {
 	// Registrar o servidor RPC
-	rpc.Register(servidor)
-	
+	rpcServidor, err := s.novoServidorRPC()
+	if err != nil {
+		return err
+	}
+
 	// Configurar o listener TCP
-	l, err := net.Listen("tcp", ":"+porta)
+	l, err := net.Listen("tcp", ":"+opcoes.Porta)
 	if err != nil {
-		log.Fatalf("Erro ao ouvir na porta %s: %v", porta, err)
+		return fmt.Errorf("erro ao ouvir na porta %s: %v", opcoes.Porta, err)
+	}
+	l = ouvirComFalhas(l, opcoes.Falhas)
+
+	fmt.Printf("Servidor iniciado na porta %s\n", opcoes.Porta)
+
+	// Amostrar a taxa de comandos enquanto o servidor estiver no ar
+	go s.metricas.amostrarTaxa(parar)
+
+	// Aceitar conexões em segundo plano
+	go s.aceitarConexoes(l, func(conn net.Conn) {
+		// Com o codec medido, os bytes de cada estado enviado entram nas
+		// métricas sem codificá-lo duas vezes (ver metricas.go)
+		rpcServidor.ServeCodec(s.metricas.medirCodec(conn, novoCodecGob))
+	})
+
+	// Endpoint JSON-RPC opcional em uma segunda porta
+	var lJSON net.Listener
+	if opcoes.PortaJSON != "" {
+		rpcJSON, err := novoServidorRPCJSON(s)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		lJSON, err = net.Listen("tcp", ":"+opcoes.PortaJSON)
+		if err != nil {
+			l.Close()
+			return fmt.Errorf("erro ao ouvir na porta JSON-RPC %s: %v", opcoes.PortaJSON, err)
+		}
+		lJSON = ouvirComFalhas(lJSON, opcoes.Falhas)
+		fmt.Printf("Servidor JSON-RPC iniciado na porta %s\n", opcoes.PortaJSON)
+		go s.aceitarConexoes(lJSON, func(conn net.Conn) {
+			rpcJSON.ServeCodec(s.metricas.medirCodec(conn, jsonrpc.NewServerCodec))
+		})
+	}
+
+	// API HTTP somente leitura e espectador web opcionais
+	if opcoes.EnderecoHTTP != "" {
+		servidorHTTP, err := s.iniciarWeb(opcoes.EnderecoHTTP)
+		if err != nil {
+			l.Close()
+			if lJSON != nil {
+				lJSON.Close()
+			}
+			return err
+		}
+		defer servidorHTTP.Close()
+	}
+
+	if pronto != nil {
+		pronto()
+	}
+
+	<-parar
+	log.Println("Encerrando servidor...")
+
+	// Parar de aceitar novas conexões
+	l.Close()
+	if lJSON != nil {
+		lJSON.Close()
+	}
+
+	s.encerrar(opcoes)
+	return nil
+}
+
+// novoServidorRPC cria um servidor net/rpc com os métodos do jogo registrados
+func (s *ServidorJogo) novoServidorRPC() (*rpc.Server, error) {
+	rpcServidor := rpc.NewServer()
+	if err := rpcServidor.RegisterName("ServidorJogo", s); err != nil {
+		return nil, err
+	}
+	return rpcServidor, nil
+}
+
+// aceitarConexoes atende cada conexão recebida em uma goroutine própria
+func (s *ServidorJogo) aceitarConexoes(l net.Listener, atender func(net.Conn)) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return // listener fechado
+		}
+		if !s.adicionarConexao(conn) {
+			conn.Close()
+			continue
+		}
+		go func() {
+			atender(conn)
+			s.removerConexao(conn)
+		}()
 	}
-	
-	fmt.Printf("Servidor iniciado na porta %s\n", porta)
-	
-	// Aceitar conexões
-	rpc.Accept(l)
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// O servidor registra cada entrada, saída e expulsão no log
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// entrarTeste coloca um jogador no jogo e retorna o seu ID
+func entrarTeste(t *testing.T, s *ServidorJogo, nome string, simbolo rune) int {
+	t.Helper()
+	reply := EntrarReply{}
+	if err := s.Entrar(&EntrarArgs{Nome: nome, Simbolo: simbolo}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if !reply.Sucesso {
+		t.Fatalf("Entrar(%q): %s", nome, reply.Mensagem)
+	}
+	return reply.JogadorID
+}
+
+// comandoTeste envia um comando, com a chave da sessão do jogador se args
+// não trouxer uma, e falha o teste se ele for recusado
+func comandoTeste(t *testing.T, s *ServidorJogo, args EnviarComandoArgs) EnviarComandoReply {
+	t.Helper()
+	if args.Sessao == "" {
+		args.Sessao = s.sessaoDe(args.JogadorID)
+	}
+	reply := EnviarComandoReply{}
+	if err := s.EnviarComando(&args, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if !reply.Sucesso {
+		t.Fatalf("EnviarComando(%+v): %s", args, reply.Mensagem)
+	}
+	return reply
+}
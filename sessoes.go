@@ -0,0 +1,45 @@
+// sessoes.go - Chaves de sessão dos jogadores
+// Cada jogador recebe em Entrar uma chave sorteada, que acompanha todas as
+// chamadas feitas em seu nome (EnviarComando, ObterEstado, Ping e Sair). O ID
+// do jogador é público, pois aparece no estado de todos; sem a chave, quem
+// souber o ID não consegue agir nem ver o jogo como aquele jogador. A chave
+// nunca vai para o registro de eventos: a reprodução usa a chave que o
+// servidor novo sorteou para cada jogador.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// Tamanho, em bytes, da chave de sessão sorteada em Entrar
+const tamanhoChaveSessao = 16
+
+// novaSessao sorteia a chave da sessão de um jogador
+func novaSessao() (string, error) {
+	chave := make([]byte, tamanhoChaveSessao)
+	if _, err := rand.Read(chave); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(chave), nil
+}
+
+// sessaoConfere indica se a chave enviada é a da sessão do jogador. A chave
+// do jogador não muda desde a entrada, então não precisa de trava.
+func sessaoConfere(j *jogadorServidor, sessao string) bool {
+	return subtle.ConstantTimeCompare([]byte(j.sessao), []byte(sessao)) == 1
+}
+
+// sessaoDe retorna a chave da sessão do jogador, ou "" se ele não estiver no
+// jogo. Usada pela reprodução do registro de eventos, que refaz as chamadas
+// dos jogadores.
+func (s *ServidorJogo) sessaoDe(id int) string {
+	s.travarLeitura()
+	defer s.mutex.RUnlock()
+
+	if j, existe := s.jogadores[id]; existe {
+		return j.sessao
+	}
+	return ""
+}
@@ -0,0 +1,320 @@
+// teclas.go - Direções de movimento e mapeamento de teclas
+// A interface traduz cada tecla em uma ação do jogo (mover em uma direção,
+// interagir ou sair) por meio de um MapaTeclas. O mapa padrão aceita WASD,
+// HJKL (em maiúsculas ou minúsculas) e as setas; um arquivo de teclas pode
+// acrescentar ou substituir associações. O servidor recebe apenas a direção,
+// nunca a tecla pressionada.
+//
+// Formato do arquivo de teclas, uma associação por linha:
+//
+//	# comentário
+//	w = cima
+//	seta_cima = cima
+//	espaco = interagir
+//	q = nenhuma        # remove a associação padrão da tecla
+//
+// Teclas são um caractere ou um dos nomes de nomesTeclas; ações são as
+// direções (cima, baixo, esquerda, direita), interagir, sair ou nenhuma.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Direcao é uma direção de movimento do personagem
+type Direcao uint8
+
+const (
+	DirecaoNenhuma Direcao = iota
+	DirecaoCima
+	DirecaoBaixo
+	DirecaoEsquerda
+	DirecaoDireita
+)
+
+// Nomes das direções, usados no arquivo de teclas, no roteiro e no JSON-RPC
+var nomesDirecoes = map[Direcao]string{
+	DirecaoCima:     "cima",
+	DirecaoBaixo:    "baixo",
+	DirecaoEsquerda: "esquerda",
+	DirecaoDireita:  "direita",
+}
+
+// String retorna o nome da direção ("" para DirecaoNenhuma)
+func (d Direcao) String() string {
+	return nomesDirecoes[d]
+}
+
+// Deslocamento retorna o deslocamento no mapa de um passo na direção
+func (d Direcao) Deslocamento() (dx, dy int) {
+	switch d {
+	case DirecaoCima:
+		return 0, -1
+	case DirecaoBaixo:
+		return 0, 1
+	case DirecaoEsquerda:
+		return -1, 0
+	case DirecaoDireita:
+		return 1, 0
+	}
+	return 0, 0
+}
+
+// direcaoPorNome retorna a direção com o nome informado
+func direcaoPorNome(nome string) (Direcao, bool) {
+	for d, n := range nomesDirecoes {
+		if n == nome {
+			return d, true
+		}
+	}
+	return DirecaoNenhuma, false
+}
+
+// direcaoDeTecla converte as teclas w, a, s e d na direção correspondente.
+// Mantida para clientes e registros de eventos que ainda enviam a tecla.
+func direcaoDeTecla(tecla rune) Direcao {
+	switch tecla {
+	case 'w':
+		return DirecaoCima
+	case 'a':
+		return DirecaoEsquerda
+	case 's':
+		return DirecaoBaixo
+	case 'd':
+		return DirecaoDireita
+	}
+	return DirecaoNenhuma
+}
+
+// AcaoTecla é a ação do jogo associada a uma tecla
+type AcaoTecla struct {
+	Tipo    string  // "mover", "interagir" ou "sair"; vazio para nenhuma ação
+	Direcao Direcao // direção, quando Tipo é "mover"
+}
+
+// Nomes das teclas especiais no arquivo de teclas
+var nomesTeclas = map[string]Tecla{
+	"esc":           TeclaEsc,
+	"enter":         TeclaEnter,
+	"backspace":     TeclaBackspace,
+	"tab":           TeclaTab,
+	"espaco":        TeclaEspaco,
+	"seta_cima":     TeclaSetaCima,
+	"seta_baixo":    TeclaSetaBaixo,
+	"seta_esquerda": TeclaSetaEsquerda,
+	"seta_direita":  TeclaSetaDireita,
+}
+
+// Nomes das teclas especiais na dica da barra de status
+var nomesExibicaoTeclas = map[Tecla]string{
+	TeclaEsc:          "ESC",
+	TeclaEnter:        "ENTER",
+	TeclaBackspace:    "BACKSPACE",
+	TeclaTab:          "TAB",
+	TeclaEspaco:       "ESPAÇO",
+	TeclaSetaCima:     "↑",
+	TeclaSetaBaixo:    "↓",
+	TeclaSetaEsquerda: "←",
+	TeclaSetaDireita:  "→",
+}
+
+// MapaTeclas associa teclas a ações do jogo
+type MapaTeclas struct {
+	especiais  map[Tecla]AcaoTecla
+	caracteres map[rune]AcaoTecla
+
+	// principais guarda, para cada ação, a tecla mostrada na dica: a do mapa
+	// padrão ou a última associada a ela no arquivo de teclas
+	principais map[AcaoTecla]EventoEntrada
+}
+
+// NovoMapaTeclasPadrao retorna o mapa de teclas padrão: WASD, HJKL e setas
+// para mover, E para interagir e ESC para sair
+func NovoMapaTeclasPadrao() *MapaTeclas {
+	m := &MapaTeclas{
+		especiais:  make(map[Tecla]AcaoTecla),
+		caracteres: make(map[rune]AcaoTecla),
+		principais: make(map[AcaoTecla]EventoEntrada),
+	}
+	mover := func(d Direcao, teclas string, seta Tecla) {
+		for _, ch := range teclas {
+			m.caracteres[ch] = AcaoTecla{Tipo: "mover", Direcao: d}
+		}
+		m.especiais[seta] = AcaoTecla{Tipo: "mover", Direcao: d}
+		m.principais[AcaoTecla{Tipo: "mover", Direcao: d}] = EventoEntrada{Ch: []rune(teclas)[0]}
+	}
+	mover(DirecaoCima, "wWkK", TeclaSetaCima)
+	mover(DirecaoBaixo, "sSjJ", TeclaSetaBaixo)
+	mover(DirecaoEsquerda, "aAhH", TeclaSetaEsquerda)
+	mover(DirecaoDireita, "dDlL", TeclaSetaDireita)
+	m.caracteres['e'] = AcaoTecla{Tipo: "interagir"}
+	m.caracteres['E'] = AcaoTecla{Tipo: "interagir"}
+	m.especiais[TeclaEsc] = AcaoTecla{Tipo: "sair"}
+	m.principais[AcaoTecla{Tipo: "interagir"}] = EventoEntrada{Ch: 'e'}
+	m.principais[AcaoTecla{Tipo: "sair"}] = EventoEntrada{Tecla: TeclaEsc}
+	return m
+}
+
+// CarregarMapaTeclas lê um arquivo de teclas e aplica suas associações
+// sobre o mapa padrão
+func CarregarMapaTeclas(arquivo string) (*MapaTeclas, error) {
+	arq, err := os.Open(arquivo)
+	if err != nil {
+		return nil, err
+	}
+	defer arq.Close()
+
+	m := NovoMapaTeclasPadrao()
+	scanner := bufio.NewScanner(arq)
+	for numero := 1; scanner.Scan(); numero++ {
+		linha := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(linha, " #"); i >= 0 {
+			linha = strings.TrimSpace(linha[:i])
+		}
+		if linha == "" || strings.HasPrefix(linha, "#") {
+			continue
+		}
+		tecla, acao, ok := strings.Cut(linha, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: use tecla = ação", arquivo, numero)
+		}
+		if err := m.associar(strings.TrimSpace(tecla), strings.TrimSpace(acao)); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", arquivo, numero, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// associar associa a tecla à ação, ambas pelo nome usado no arquivo de teclas
+func (m *MapaTeclas) associar(tecla, acao string) error {
+	var a AcaoTecla
+	switch acao {
+	case "interagir", "sair":
+		a.Tipo = acao
+	case "nenhuma":
+	default:
+		d, ok := direcaoPorNome(acao)
+		if !ok {
+			return fmt.Errorf("ação desconhecida %q", acao)
+		}
+		a = AcaoTecla{Tipo: "mover", Direcao: d}
+	}
+
+	if especial, ok := nomesTeclas[tecla]; ok {
+		if a.Tipo == "" {
+			delete(m.especiais, especial)
+		} else {
+			m.especiais[especial] = a
+			m.principais[a] = EventoEntrada{Tecla: especial}
+		}
+		return nil
+	}
+	r := []rune(tecla)
+	if len(r) != 1 {
+		return fmt.Errorf("tecla desconhecida %q", tecla)
+	}
+	if a.Tipo == "" {
+		delete(m.caracteres, r[0])
+	} else {
+		m.caracteres[r[0]] = a
+		m.principais[a] = EventoEntrada{Ch: r[0]}
+	}
+	return nil
+}
+
+// Acao retorna a ação associada ao evento de tecla (vazia se não houver)
+func (m *MapaTeclas) Acao(ev EventoEntrada) AcaoTecla {
+	if ev.Tecla != TeclaNenhuma {
+		return m.especiais[ev.Tecla]
+	}
+	return m.caracteres[ev.Ch]
+}
+
+// teclaDe retorna a tecla a mostrar para a ação: a principal, se ainda
+// estiver associada a ela, ou senão o menor caractere e depois a primeira
+// tecla especial associados à ação
+func (m *MapaTeclas) teclaDe(a AcaoTecla) (EventoEntrada, bool) {
+	if ev, ok := m.principais[a]; ok && m.Acao(ev) == a {
+		return ev, true
+	}
+
+	var caracteres []rune
+	for ch, acao := range m.caracteres {
+		if acao == a {
+			caracteres = append(caracteres, ch)
+		}
+	}
+	if len(caracteres) > 0 {
+		sort.Slice(caracteres, func(i, j int) bool { return caracteres[i] < caracteres[j] })
+		return EventoEntrada{Ch: caracteres[0]}, true
+	}
+
+	var especiais []Tecla
+	for tecla, acao := range m.especiais {
+		if acao == a {
+			especiais = append(especiais, tecla)
+		}
+	}
+	if len(especiais) > 0 {
+		sort.Slice(especiais, func(i, j int) bool { return especiais[i] < especiais[j] })
+		return EventoEntrada{Tecla: especiais[0]}, true
+	}
+	return EventoEntrada{}, false
+}
+
+// nomeExibicaoTecla retorna o nome da tecla na dica: o caractere em
+// maiúscula ou o nome da tecla especial
+func nomeExibicaoTecla(ev EventoEntrada) string {
+	if ev.Tecla != TeclaNenhuma {
+		return nomesExibicaoTeclas[ev.Tecla]
+	}
+	return string(unicode.ToUpper(ev.Ch))
+}
+
+// Dica descreve as teclas de mover, interagir e sair do mapa, como em
+// "Use WASD para mover e E para interagir. ESC para sair."; ações sem tecla
+// ficam de fora
+func (m *MapaTeclas) Dica() string {
+	var mover []string
+	juntas := true
+	for _, d := range []Direcao{DirecaoCima, DirecaoEsquerda, DirecaoBaixo, DirecaoDireita} {
+		ev, ok := m.teclaDe(AcaoTecla{Tipo: "mover", Direcao: d})
+		if !ok {
+			continue
+		}
+		nome := nomeExibicaoTecla(ev)
+		if len([]rune(nome)) != 1 {
+			juntas = false
+		}
+		mover = append(mover, nome)
+	}
+
+	var usos []string
+	if len(mover) > 0 {
+		separador := "/"
+		if juntas {
+			separador = ""
+		}
+		usos = append(usos, strings.Join(mover, separador)+" para mover")
+	}
+	if ev, ok := m.teclaDe(AcaoTecla{Tipo: "interagir"}); ok {
+		usos = append(usos, nomeExibicaoTecla(ev)+" para interagir")
+	}
+
+	var frases []string
+	if len(usos) > 0 {
+		frases = append(frases, "Use "+strings.Join(usos, " e ")+".")
+	}
+	if ev, ok := m.teclaDe(AcaoTecla{Tipo: "sair"}); ok {
+		frases = append(frases, nomeExibicaoTecla(ev)+" para sair.")
+	}
+	return strings.Join(frases, " ")
+}
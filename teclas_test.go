@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDicaMapaPadrao(t *testing.T) {
+	esperada := "Use WASD para mover e E para interagir. ESC para sair."
+	if dica := NovoMapaTeclasPadrao().Dica(); dica != esperada {
+		t.Errorf("dica = %q, esperada %q", dica, esperada)
+	}
+}
+
+func TestDicaMapaDoArquivo(t *testing.T) {
+	arquivo := filepath.Join(t.TempDir(), "teclas.txt")
+	conteudo := strings.Join([]string{
+		"i = cima",
+		"j = esquerda",
+		"k = baixo",
+		"l = direita",
+		"e = nenhuma",
+		"E = nenhuma",
+		"espaco = interagir",
+		"esc = nenhuma",
+		"q = sair",
+	}, "\n")
+	if err := os.WriteFile(arquivo, []byte(conteudo), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := CarregarMapaTeclas(arquivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	esperada := "Use IJKL para mover e ESPAÇO para interagir. Q para sair."
+	if dica := m.Dica(); dica != esperada {
+		t.Errorf("dica = %q, esperada %q", dica, esperada)
+	}
+}
+
+func TestBarraDeStatusUsaMapaDeTeclas(t *testing.T) {
+	m := NovoMapaTeclasPadrao()
+	if err := m.associar("x", "interagir"); err != nil {
+		t.Fatal(err)
+	}
+	anterior := teclas
+	interfaceDefinirTeclas(m)
+	t.Cleanup(func() { interfaceDefinirTeclas(anterior) })
+
+	jogo, tela := jogoTeste(t)
+	esperarQuadro(t, jogo, tela, func() bool {
+		return strings.Contains(tela.UltimoQuadro(), "Use WASD para mover e X para interagir.")
+	})
+}
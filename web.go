@@ -0,0 +1,208 @@
+// web.go - API HTTP/JSON somente leitura e página de espectador
+// O endpoint /estado devolve jogadores, dimensões do mapa e mensagens recentes,
+// /mapa devolve as linhas do mapa e /eventos transmite o estado como
+// server-sent events a cada mudança. A raiz serve a página web/index.html,
+// embutida no binário, que desenha o mapa em uma grade.
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+//go:embed web
+var arquivosWeb embed.FS
+
+// Quantidade de mensagens enviadas em /estado
+const mensagensRecentes = 20
+
+// EstadoWeb é o corpo de /estado e de cada evento de /eventos
+type EstadoWeb struct {
+	Versao               uint64        `json:"versao"`
+	Largura              int           `json:"largura"`
+	Altura               int           `json:"altura"`
+	Jogadores            []JogadorJSON `json:"jogadores"`
+	Mensagens            []string      `json:"mensagens"`
+	Encerrando           bool          `json:"encerrando"`
+	SegundosParaEncerrar int           `json:"segundos_para_encerrar"`
+}
+
+// MapaWeb é o corpo de /mapa
+type MapaWeb struct {
+	Largura int      `json:"largura"`
+	Altura  int      `json:"altura"`
+	Linhas  []string `json:"linhas"`
+}
+
+// assinar retorna um canal avisado a cada mudança de estado
+func (s *ServidorJogo) assinar() chan struct{} {
+	s.mutexAvisos.Lock()
+	defer s.mutexAvisos.Unlock()
+
+	ch := make(chan struct{}, 1)
+	s.assinantes[ch] = struct{}{}
+	atomic.StoreInt32(&s.numAssinantes, int32(len(s.assinantes)))
+	return ch
+}
+
+// cancelarAssinatura deixa de avisar o canal
+func (s *ServidorJogo) cancelarAssinatura(ch chan struct{}) {
+	s.mutexAvisos.Lock()
+	defer s.mutexAvisos.Unlock()
+
+	delete(s.assinantes, ch)
+	atomic.StoreInt32(&s.numAssinantes, int32(len(s.assinantes)))
+}
+
+// larguraMapa retorna o comprimento da maior linha do mapa
+func larguraMapa(mapa [][]Elemento) int {
+	largura := 0
+	for _, linha := range mapa {
+		if len(linha) > largura {
+			largura = len(linha)
+		}
+	}
+	return largura
+}
+
+// estadoWeb monta o corpo de /estado a partir do estado atual
+func (s *ServidorJogo) estadoWeb() EstadoWeb {
+	s.mutex.RLock()
+	estado := s.copiarEstado()
+	s.mutex.RUnlock()
+
+	convertido := estadoParaJSON(estado)
+	mensagens := convertido.Mensagens
+	if len(mensagens) > mensagensRecentes {
+		mensagens = mensagens[len(mensagens)-mensagensRecentes:]
+	}
+
+	return EstadoWeb{
+		Versao:               estado.Versao,
+		Largura:              larguraMapa(estado.ElementosMapa),
+		Altura:               len(estado.ElementosMapa),
+		Jogadores:            convertido.Jogadores,
+		Mensagens:            mensagens,
+		Encerrando:           estado.Encerrando,
+		SegundosParaEncerrar: estado.SegundosParaEncerrar,
+	}
+}
+
+// novoManipuladorWeb cria o roteador HTTP do espectador
+func novoManipuladorWeb(s *ServidorJogo) http.Handler {
+	mux := http.NewServeMux()
+
+	estaticos, err := fs.Sub(arquivosWeb, "web")
+	if err != nil {
+		panic(err) // o diretório é embutido na compilação
+	}
+	mux.Handle("/", http.FileServer(http.FS(estaticos)))
+
+	mux.HandleFunc("/estado", func(w http.ResponseWriter, r *http.Request) {
+		responderJSON(w, s.estadoWeb())
+	})
+
+	mux.HandleFunc("/mapa", func(w http.ResponseWriter, r *http.Request) {
+		// O mapa não muda depois de carregado, então não precisa do mutex
+		linhas := estadoParaJSON(EstadoJogo{ElementosMapa: s.estado.ElementosMapa}).Mapa
+		responderJSON(w, MapaWeb{
+			Largura: larguraMapa(s.estado.ElementosMapa),
+			Altura:  len(linhas),
+			Linhas:  linhas,
+		})
+	})
+
+	mux.HandleFunc("/eventos", func(w http.ResponseWriter, r *http.Request) {
+		s.transmitirEventos(w, r)
+	})
+
+	registrarRotasMetricas(mux, s)
+
+	return mux
+}
+
+// responderJSON escreve v como resposta JSON
+func responderJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Erro ao responder JSON: %v", err)
+	}
+}
+
+// transmitirEventos envia o estado como server-sent events a cada mudança
+func (s *ServidorJogo) transmitirEventos(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming não suportado", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	mudancas := s.assinar()
+	defer s.cancelarAssinatura(mudancas)
+
+	// Comentários periódicos mantêm a conexão aberta através de proxies
+	pulso := time.NewTicker(15 * time.Second)
+	defer pulso.Stop()
+
+	enviar := func() bool {
+		dados, err := json.Marshal(s.estadoWeb())
+		if err != nil {
+			log.Printf("Erro ao codificar estado: %v", err)
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: estado\ndata: %s\n\n", dados); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	// Estado inicial e, depois, um evento por mudança
+	if !enviar() {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-pulso.C:
+			if _, err := fmt.Fprint(w, ": pulso\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-mudancas:
+			if !enviar() {
+				return
+			}
+		}
+	}
+}
+
+// iniciarWeb abre o listener HTTP do espectador e o atende em segundo plano
+func (s *ServidorJogo) iniciarWeb(endereco string) (*http.Server, error) {
+	l, err := net.Listen("tcp", endereco)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ouvir HTTP em %s: %v", endereco, err)
+	}
+
+	servidorHTTP := &http.Server{Handler: novoManipuladorWeb(s)}
+	go func() {
+		if err := servidorHTTP.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Printf("Erro no servidor HTTP: %v", err)
+		}
+	}()
+
+	fmt.Printf("Espectador web em http://%s/\n", l.Addr())
+	return servidorHTTP, nil
+}